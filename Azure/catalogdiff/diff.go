@@ -0,0 +1,128 @@
+package catalogdiff
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Report lists what changed in the catalog between two snapshots
+type Report struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	NewRegions     []RegionEntry `json:"newRegions"`
+	RemovedRegions []RegionEntry `json:"removedRegions"`
+	NewSkus        []SkuEntry    `json:"newSkus"`
+	RetiredSkus    []SkuEntry    `json:"retiredSkus"`
+	PriceIncreases []PriceChange `json:"priceIncreases"`
+	PriceDecreases []PriceChange `json:"priceDecreases"`
+	NewTerms       []TermEntry   `json:"newTerms"`
+	RemovedTerms   []TermEntry   `json:"removedTerms"`
+}
+
+// PriceChange is a price series whose retail price changed
+type PriceChange struct {
+	Before PriceEntry `json:"before"`
+	After  PriceEntry `json:"after"`
+	// ChangePercent is the relative change, nil when the old price was zero
+	ChangePercent *float64 `json:"changePercent"`
+}
+
+// Diff compares two snapshots. Prices are compared per series (SKU, meter, tier,
+// reservation term and currency), so a new price replacing an old one is a change;
+// series that only exist on one side belong to new or retired SKUs and are not listed
+// again.
+func Diff(before, after *Snapshot) *Report {
+	report := &Report{
+		From:           before.TakenAt,
+		To:             after.TakenAt,
+		PriceIncreases: []PriceChange{},
+		PriceDecreases: []PriceChange{},
+	}
+
+	report.NewRegions, report.RemovedRegions = added(before.Regions, after.Regions, RegionEntry.Key)
+	report.NewSkus, report.RetiredSkus = added(before.Skus, after.Skus, SkuEntry.Key)
+	report.NewTerms, report.RemovedTerms = added(before.Terms, after.Terms, TermEntry.Key)
+
+	old := make(map[string]PriceEntry, len(before.Prices))
+	for _, price := range before.Prices {
+		old[price.Key()] = price
+	}
+	for _, price := range after.Prices {
+		previous, ok := old[price.Key()]
+		if !ok || previous.RetailPrice == price.RetailPrice {
+			continue
+		}
+
+		change := PriceChange{Before: previous, After: price}
+		if previous.RetailPrice != 0 {
+			percent := (price.RetailPrice - previous.RetailPrice) / previous.RetailPrice * 100
+			change.ChangePercent = &percent
+		}
+		if price.RetailPrice > previous.RetailPrice {
+			report.PriceIncreases = append(report.PriceIncreases, change)
+		} else {
+			report.PriceDecreases = append(report.PriceDecreases, change)
+		}
+	}
+
+	// Biggest relative changes first; changes from zero have no percentage and go last
+	byMagnitude := func(changes []PriceChange) func(i, j int) bool {
+		return func(i, j int) bool {
+			a, b := changes[i].ChangePercent, changes[j].ChangePercent
+			if a == nil || b == nil {
+				return a != nil
+			}
+			return abs(*a) > abs(*b)
+		}
+	}
+	sort.SliceStable(report.PriceIncreases, byMagnitude(report.PriceIncreases))
+	sort.SliceStable(report.PriceDecreases, byMagnitude(report.PriceDecreases))
+	return report
+}
+
+// Empty reports whether nothing changed
+func (r *Report) Empty() bool {
+	return len(r.NewRegions)+len(r.RemovedRegions)+len(r.NewSkus)+len(r.RetiredSkus)+
+		len(r.PriceIncreases)+len(r.PriceDecreases)+len(r.NewTerms)+len(r.RemovedTerms) == 0
+}
+
+// JSON returns the machine readable report
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// added returns the entries only present in after, and the ones only present in
+// before, each sorted by key. Both are non-nil so empty lists encode as [].
+func added[T any](before, after []T, key func(T) string) (onlyAfter, onlyBefore []T) {
+	onlyAfter, onlyBefore = []T{}, []T{}
+	inBefore := make(map[string]bool, len(before))
+	for _, entry := range before {
+		inBefore[key(entry)] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, entry := range after {
+		k := key(entry)
+		inAfter[k] = true
+		if !inBefore[k] {
+			onlyAfter = append(onlyAfter, entry)
+		}
+	}
+	for _, entry := range before {
+		if !inAfter[key(entry)] {
+			onlyBefore = append(onlyBefore, entry)
+		}
+	}
+
+	sort.Slice(onlyAfter, func(i, j int) bool { return key(onlyAfter[i]) < key(onlyAfter[j]) })
+	sort.Slice(onlyBefore, func(i, j int) bool { return key(onlyBefore[i]) < key(onlyBefore[j]) })
+	return onlyAfter, onlyBefore
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
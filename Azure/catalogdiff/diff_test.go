@@ -0,0 +1,154 @@
+package catalogdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdded(t *testing.T) {
+	key := func(s string) string { return strings.ToLower(s) }
+	tests := []struct {
+		name                string
+		before, after       []string
+		wantAdded, wantGone []string
+	}{
+		{"both empty", nil, nil, []string{}, []string{}},
+		{"unchanged", []string{"a", "b"}, []string{"b", "a"}, []string{}, []string{}},
+		{"all new", nil, []string{"c", "a"}, []string{"a", "c"}, []string{}},
+		{"all gone", []string{"c", "a"}, nil, []string{}, []string{"a", "c"}},
+		{"mixed and sorted", []string{"d", "b", "a"}, []string{"a", "e", "c"}, []string{"c", "e"}, []string{"b", "d"}},
+		{"compared by key", []string{"A"}, []string{"a"}, []string{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAdded, gotGone := added(tt.before, tt.after, key)
+			if !reflect.DeepEqual(gotAdded, tt.wantAdded) || !reflect.DeepEqual(gotGone, tt.wantGone) {
+				t.Errorf("got %v and %v, want %v and %v", gotAdded, gotGone, tt.wantAdded, tt.wantGone)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	d4 := SkuEntry{SkuCode: "DZH318Z0BQPS/00TG", Region: "eastus", Type: "Consumption", ArmSkuName: "Standard_D4s_v5"}
+	d8 := SkuEntry{SkuCode: "DZH318Z0BQPS/00TH", Region: "eastus", Type: "Consumption", ArmSkuName: "Standard_D8s_v5"}
+	e4 := SkuEntry{SkuCode: "DZH318Z0BQ4S/0015", Region: "westeurope", Type: "Consumption", ArmSkuName: "Standard_E4s_v5"}
+	price := func(sku SkuEntry, meter string, retail float64) PriceEntry {
+		return PriceEntry{SkuEntry: sku, MeterID: meter, CurrencyCode: "USD", RetailPrice: retail, Unit: "1 Hour"}
+	}
+	percent := func(p float64) *float64 { return &p }
+
+	tests := []struct {
+		name          string
+		before, after Snapshot
+		check         func(t *testing.T, r *Report)
+	}{
+		{
+			name:   "no changes",
+			before: Snapshot{Regions: []RegionEntry{{"eastus", "AzurePublic"}}, Skus: []SkuEntry{d4}, Prices: []PriceEntry{price(d4, "m1", 0.2)}},
+			after:  Snapshot{Regions: []RegionEntry{{"eastus", "AzurePublic"}}, Skus: []SkuEntry{d4}, Prices: []PriceEntry{price(d4, "m1", 0.2)}},
+			check: func(t *testing.T, r *Report) {
+				if !r.Empty() {
+					t.Errorf("got changes %+v", r)
+				}
+			},
+		},
+		{
+			name:   "regions and SKUs",
+			before: Snapshot{Regions: []RegionEntry{{"eastus", "AzurePublic"}, {"brazilus", "AzurePublic"}}, Skus: []SkuEntry{d4, d8}},
+			after:  Snapshot{Regions: []RegionEntry{{"eastus", "AzurePublic"}, {"westeurope", "AzurePublic"}}, Skus: []SkuEntry{d4, e4}},
+			check: func(t *testing.T, r *Report) {
+				if !reflect.DeepEqual(r.NewRegions, []RegionEntry{{"westeurope", "AzurePublic"}}) ||
+					!reflect.DeepEqual(r.RemovedRegions, []RegionEntry{{"brazilus", "AzurePublic"}}) {
+					t.Errorf("regions: new %v, removed %v", r.NewRegions, r.RemovedRegions)
+				}
+				if !reflect.DeepEqual(r.NewSkus, []SkuEntry{e4}) || !reflect.DeepEqual(r.RetiredSkus, []SkuEntry{d8}) {
+					t.Errorf("SKUs: new %v, retired %v", r.NewSkus, r.RetiredSkus)
+				}
+			},
+		},
+		{
+			name:   "price changes sorted by magnitude",
+			before: Snapshot{Prices: []PriceEntry{price(d4, "m1", 0.2), price(d4, "m2", 1), price(d8, "m1", 0), price(d8, "m2", 0.5)}},
+			after:  Snapshot{Prices: []PriceEntry{price(d4, "m1", 0.21), price(d4, "m2", 2), price(d8, "m1", 0.1), price(d8, "m2", 0.4)}},
+			check: func(t *testing.T, r *Report) {
+				if len(r.PriceIncreases) != 3 || len(r.PriceDecreases) != 1 {
+					t.Fatalf("got %d increases and %d decreases", len(r.PriceIncreases), len(r.PriceDecreases))
+				}
+				want := []*float64{percent(100), percent(5), nil}
+				for i, change := range r.PriceIncreases {
+					got, exp := change.ChangePercent, want[i]
+					if (got == nil) != (exp == nil) || (got != nil && abs(*got-*exp) > 1e-9) {
+						t.Errorf("increase %d: %s/%s changed by %v", i, change.After.ArmSkuName, change.After.MeterID, got)
+					}
+				}
+				if d := r.PriceDecreases[0]; d.Before.RetailPrice != 0.5 || d.After.RetailPrice != 0.4 || abs(*d.ChangePercent+20) > 1e-9 {
+					t.Errorf("decrease: %+v", d)
+				}
+			},
+		},
+		{
+			name:   "prices of new or retired SKUs are not changes",
+			before: Snapshot{Skus: []SkuEntry{d4}, Prices: []PriceEntry{price(d4, "m1", 0.2)}},
+			after:  Snapshot{Skus: []SkuEntry{d8}, Prices: []PriceEntry{price(d8, "m1", 0.4)}},
+			check: func(t *testing.T, r *Report) {
+				if len(r.PriceIncreases)+len(r.PriceDecreases) != 0 {
+					t.Errorf("got price changes %v %v", r.PriceIncreases, r.PriceDecreases)
+				}
+			},
+		},
+		{
+			name: "series differ by currency and term",
+			before: Snapshot{Prices: []PriceEntry{
+				price(d4, "m1", 0.2),
+				{SkuEntry: d4, MeterID: "m1", CurrencyCode: "EUR", RetailPrice: 0.18},
+			}},
+			after: Snapshot{Prices: []PriceEntry{
+				price(d4, "m1", 0.2),
+				{SkuEntry: d4, MeterID: "m1", CurrencyCode: "EUR", RetailPrice: 0.19},
+				{SkuEntry: d4, MeterID: "m1", CurrencyCode: "USD", ReservationTerm: "1 Year", RetailPrice: 900},
+			}},
+			check: func(t *testing.T, r *Report) {
+				if len(r.PriceIncreases) != 1 || r.PriceIncreases[0].After.CurrencyCode != "EUR" {
+					t.Errorf("got increases %+v", r.PriceIncreases)
+				}
+			},
+		},
+		{
+			name:   "terms",
+			before: Snapshot{Terms: []TermEntry{{SkuEntry: d4, MeterID: "m1", CurrencyCode: "USD", PurchaseOption: "Savings Plan", LeaseContractLength: "1 Year"}}},
+			after:  Snapshot{Terms: []TermEntry{{SkuEntry: d4, MeterID: "m1", CurrencyCode: "USD", PurchaseOption: "Savings Plan", LeaseContractLength: "3 Years"}}},
+			check: func(t *testing.T, r *Report) {
+				if len(r.NewTerms) != 1 || r.NewTerms[0].LeaseContractLength != "3 Years" ||
+					len(r.RemovedTerms) != 1 || r.RemovedTerms[0].LeaseContractLength != "1 Year" {
+					t.Errorf("terms: new %v, removed %v", r.NewTerms, r.RemovedTerms)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.before.TakenAt = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+			tt.after.TakenAt = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+			r := Diff(&tt.before, &tt.after)
+			if !r.From.Equal(tt.before.TakenAt) || !r.To.Equal(tt.after.TakenAt) {
+				t.Errorf("report covers %s to %s", r.From, r.To)
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestReportJSONEncodesEmptyLists(t *testing.T) {
+	data, err := Diff(&Snapshot{}, &Snapshot{}).JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "null") {
+		t.Errorf("empty report has null lists:\n%s", data)
+	}
+}
@@ -0,0 +1,37 @@
+package catalogdiff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileTimeFormat names snapshot and report files so that they sort chronologically
+const fileTimeFormat = "20060102T150405Z"
+
+// SnapshotPath returns the file a snapshot taken at t is stored under in dir
+func SnapshotPath(dir string, t time.Time) string {
+	return filepath.Join(dir, "snapshot-"+t.UTC().Format(fileTimeFormat)+".json.gz")
+}
+
+// WriteReport writes the report to dir as report-<to>.json and report-<to>.md and
+// returns both paths
+func WriteReport(dir string, report *Report) (jsonPath, markdownPath string, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("error creating report directory: %w", err)
+	}
+	base := filepath.Join(dir, "report-"+report.To.UTC().Format(fileTimeFormat))
+
+	data, err := report.JSON()
+	if err != nil {
+		return "", "", fmt.Errorf("error encoding report: %w", err)
+	}
+	if err := os.WriteFile(base+".json", data, 0o644); err != nil {
+		return "", "", fmt.Errorf("error writing report: %w", err)
+	}
+	if err := os.WriteFile(base+".md", []byte(report.Markdown()), 0o644); err != nil {
+		return "", "", fmt.Errorf("error writing report summary: %w", err)
+	}
+	return base + ".json", base + ".md", nil
+}
@@ -0,0 +1,111 @@
+package catalogdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdownSectionLimit bounds the rows listed per section of the Markdown summary; the
+// JSON report always has every change
+const markdownSectionLimit = 50
+
+// Markdown returns a human readable summary of the report
+func (r *Report) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Catalog changes %s → %s\n\n", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	if r.Empty() {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+
+	b.WriteString("| Change | Count |\n|---|---:|\n")
+	for _, row := range []struct {
+		label string
+		count int
+	}{
+		{"New regions", len(r.NewRegions)},
+		{"Removed regions", len(r.RemovedRegions)},
+		{"New SKUs", len(r.NewSkus)},
+		{"Retired SKUs", len(r.RetiredSkus)},
+		{"Price increases", len(r.PriceIncreases)},
+		{"Price decreases", len(r.PriceDecreases)},
+		{"New terms", len(r.NewTerms)},
+		{"Removed terms", len(r.RemovedTerms)},
+	} {
+		fmt.Fprintf(&b, "| %s | %d |\n", row.label, row.count)
+	}
+
+	regionRows := func(entries []RegionEntry) [][]string {
+		rows := make([][]string, len(entries))
+		for i, e := range entries {
+			rows[i] = []string{e.Code, e.Cloud}
+		}
+		return rows
+	}
+	skuRows := func(entries []SkuEntry) [][]string {
+		rows := make([][]string, len(entries))
+		for i, e := range entries {
+			rows[i] = []string{e.ArmSkuName, e.Region, e.Type, e.SkuCode}
+		}
+		return rows
+	}
+	priceRows := func(changes []PriceChange) [][]string {
+		rows := make([][]string, len(changes))
+		for i, c := range changes {
+			percent := "n/a"
+			if c.ChangePercent != nil {
+				percent = fmt.Sprintf("%+.2f%%", *c.ChangePercent)
+			}
+			rows[i] = []string{
+				c.After.ArmSkuName, c.After.Region, c.After.Type,
+				fmt.Sprintf("%g %s", c.Before.RetailPrice, c.Before.CurrencyCode),
+				fmt.Sprintf("%g %s", c.After.RetailPrice, c.After.CurrencyCode),
+				percent, c.After.Unit,
+			}
+		}
+		return rows
+	}
+	termRows := func(entries []TermEntry) [][]string {
+		rows := make([][]string, len(entries))
+		for i, e := range entries {
+			rows[i] = []string{e.ArmSkuName, e.Region, e.Type, e.PurchaseOption, e.LeaseContractLength, e.CurrencyCode}
+		}
+		return rows
+	}
+
+	skuHeader := []string{"SKU", "Region", "Type", "skuId"}
+	priceHeader := []string{"SKU", "Region", "Type", "Before", "After", "Change", "Unit"}
+	termHeader := []string{"SKU", "Region", "Type", "Purchase option", "Term", "Currency"}
+
+	writeSection(&b, "New regions", []string{"Region", "Cloud"}, regionRows(r.NewRegions))
+	writeSection(&b, "Removed regions", []string{"Region", "Cloud"}, regionRows(r.RemovedRegions))
+	writeSection(&b, "New SKUs", skuHeader, skuRows(r.NewSkus))
+	writeSection(&b, "Retired SKUs", skuHeader, skuRows(r.RetiredSkus))
+	writeSection(&b, "Price increases", priceHeader, priceRows(r.PriceIncreases))
+	writeSection(&b, "Price decreases", priceHeader, priceRows(r.PriceDecreases))
+	writeSection(&b, "New terms", termHeader, termRows(r.NewTerms))
+	writeSection(&b, "Removed terms", termHeader, termRows(r.RemovedTerms))
+	return b.String()
+}
+
+// writeSection writes a Markdown table, skipping empty sections and cutting long ones
+func writeSection(b *strings.Builder, title string, header []string, rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n\n", title)
+	fmt.Fprintf(b, "| %s |\n|%s\n", strings.Join(header, " | "), strings.Repeat("---|", len(header)))
+
+	for i, row := range rows {
+		if i == markdownSectionLimit {
+			fmt.Fprintf(b, "\n… and %d more, see the JSON report.\n", len(rows)-markdownSectionLimit)
+			break
+		}
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		fmt.Fprintf(b, "| %s |\n", strings.Join(cells, " | "))
+	}
+}
@@ -0,0 +1,91 @@
+package catalogdiff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdown(t *testing.T) {
+	from := time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 6, 30, 0, 0, time.UTC)
+	sku := SkuEntry{SkuCode: "DZH318Z0BQPS/00TG", Region: "eastus", Type: "Consumption", ArmSkuName: "Standard_D4s_v5"}
+	percent := 5.0
+
+	tests := []struct {
+		name       string
+		report     Report
+		contains   []string
+		notContain []string
+	}{
+		{
+			name:       "empty",
+			report:     Report{From: from, To: to},
+			contains:   []string{"# Catalog changes 2024-05-01 06:00 → 2024-06-01 06:30\n", "No changes.\n"},
+			notContain: []string{"| Change | Count |"},
+		},
+		{
+			name: "sections",
+			report: Report{
+				From: from, To: to,
+				NewRegions:     []RegionEntry{{"westeurope", "AzurePublic"}},
+				RetiredSkus:    []SkuEntry{sku},
+				PriceIncreases: []PriceChange{{Before: PriceEntry{SkuEntry: sku, RetailPrice: 0.2, CurrencyCode: "USD"}, After: PriceEntry{SkuEntry: sku, RetailPrice: 0.21, CurrencyCode: "USD", Unit: "1 Hour"}, ChangePercent: &percent}},
+				PriceDecreases: []PriceChange{{Before: PriceEntry{SkuEntry: sku, CurrencyCode: "USD"}, After: PriceEntry{SkuEntry: sku, RetailPrice: 0.1, CurrencyCode: "USD", Unit: "1 Hour"}}},
+			},
+			contains: []string{
+				"| New regions | 1 |\n",
+				"| Removed regions | 0 |\n",
+				"| Retired SKUs | 1 |\n",
+				"\n## New regions\n\n| Region | Cloud |\n|---|---|\n| westeurope | AzurePublic |\n",
+				"\n## Retired SKUs\n\n| SKU | Region | Type | skuId |\n|---|---|---|---|\n| Standard_D4s_v5 | eastus | Consumption | DZH318Z0BQPS/00TG |\n",
+				"| Standard_D4s_v5 | eastus | Consumption | 0.2 USD | 0.21 USD | +5.00% | 1 Hour |\n",
+				"| Standard_D4s_v5 | eastus | Consumption | 0 USD | 0.1 USD | n/a | 1 Hour |\n",
+			},
+			notContain: []string{"## Removed regions", "## New SKUs", "No changes."},
+		},
+		{
+			name: "pipes are escaped",
+			report: Report{
+				From: from, To: to,
+				NewSkus: []SkuEntry{{SkuCode: "a|b", Region: "eastus", Type: "Consumption", ArmSkuName: "Standard_X"}},
+			},
+			contains: []string{`| Standard_X | eastus | Consumption | a\|b |`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.report.Markdown()
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("missing %q in:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.notContain {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("unexpected %q in:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownCutsLongSections(t *testing.T) {
+	report := Report{}
+	for i := 0; i < markdownSectionLimit+7; i++ {
+		report.NewRegions = append(report.NewRegions, RegionEntry{Code: fmt.Sprintf("region%03d", i), Cloud: "AzurePublic"})
+	}
+
+	got := report.Markdown()
+	if rows := strings.Count(got, "| AzurePublic |"); rows != markdownSectionLimit {
+		t.Errorf("listed %d regions, want %d", rows, markdownSectionLimit)
+	}
+	if !strings.Contains(got, "… and 7 more, see the JSON report.") {
+		t.Errorf("missing the remainder note in:\n%s", got)
+	}
+	if !strings.Contains(got, fmt.Sprintf("| New regions | %d |", markdownSectionLimit+7)) {
+		t.Error("the summary does not count every region")
+	}
+}
@@ -0,0 +1,121 @@
+package catalogdiff
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot is the catalog state at one point in time. Rows are identified by their
+// natural keys rather than database IDs, so snapshots of different databases, or of the
+// same database before and after IDs were reassigned, can be compared.
+type Snapshot struct {
+	TakenAt time.Time     `json:"takenAt"`
+	Regions []RegionEntry `json:"regions"`
+	Skus    []SkuEntry    `json:"skus"`
+	Prices  []PriceEntry  `json:"prices"` // prices in effect when the snapshot was taken
+	Terms   []TermEntry   `json:"terms"`
+}
+
+// RegionEntry is a region of the catalog
+type RegionEntry struct {
+	Code  string `json:"code"`
+	Cloud string `json:"cloud"`
+}
+
+// SkuEntry is a SKU of the price feed in one region and price type
+type SkuEntry struct {
+	SkuCode    string `json:"skuCode"` // skuId of the price API
+	Region     string `json:"region"`
+	Type       string `json:"type"` // Consumption, Reservation, DevTestConsumption
+	ArmSkuName string `json:"armSkuName"`
+}
+
+// PriceEntry is the price of one meter and tier of a SKU
+type PriceEntry struct {
+	SkuEntry
+	MeterID          string    `json:"meterId"`
+	TierMinimumUnits float64   `json:"tierMinimumUnits"`
+	ReservationTerm  string    `json:"reservationTerm,omitempty"`
+	CurrencyCode     string    `json:"currencyCode"`
+	RetailPrice      float64   `json:"retailPrice"`
+	Unit             string    `json:"unit"`
+	EffectiveDate    time.Time `json:"effectiveDate"`
+}
+
+// TermEntry is a savings plan or reservation term attached to a price
+type TermEntry struct {
+	SkuEntry
+	MeterID             string `json:"meterId"`
+	CurrencyCode        string `json:"currencyCode"`
+	PurchaseOption      string `json:"purchaseOption"`
+	LeaseContractLength string `json:"leaseContractLength"`
+}
+
+// Key returns the natural key of the region
+func (r RegionEntry) Key() string {
+	return r.Cloud + "|" + r.Code
+}
+
+// Key returns the natural key of the SKU
+func (s SkuEntry) Key() string {
+	return s.SkuCode + "|" + s.Region + "|" + s.Type
+}
+
+// Key returns the key of the price series the price belongs to. The effective date is
+// not part of it, so a new price for the same meter is reported as a change.
+func (p PriceEntry) Key() string {
+	return strings.Join([]string{p.SkuEntry.Key(), p.MeterID, strconv.FormatFloat(p.TierMinimumUnits, 'f', -1, 64), p.ReservationTerm, p.CurrencyCode}, "|")
+}
+
+// Key returns the natural key of the term
+func (t TermEntry) Key() string {
+	return strings.Join([]string{t.SkuEntry.Key(), t.MeterID, t.CurrencyCode, t.PurchaseOption, t.LeaseContractLength}, "|")
+}
+
+// Save writes the snapshot to path as JSON, gzip compressed when path ends in .gz
+func (s *Snapshot) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(path, ".gz") {
+		return json.NewEncoder(file).Encode(s)
+	}
+	zw := gzip.NewWriter(file)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	return zw.Close()
+}
+
+// LoadSnapshot reads a snapshot written by Save
+func LoadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot %s: %w", path, err)
+		}
+		defer zr.Close()
+		decoder = json.NewDecoder(zr)
+	}
+
+	var snapshot Snapshot
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
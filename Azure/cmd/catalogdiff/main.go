@@ -0,0 +1,70 @@
+// Command catalogdiff compares two stored catalog snapshots, or takes a new snapshot of
+// the database, and reports what changed between them.
+//
+//	go run ./cmd/catalogdiff -take /tmp/before.json.gz
+//	go run ./cmd/catalogdiff /tmp/before.json.gz /tmp/after.json.gz
+//	go run ./cmd/catalogdiff -json /tmp/before.json.gz /tmp/after.json.gz
+//	go run ./cmd/catalogdiff -out reports /tmp/before.json.gz /tmp/after.json.gz
+package main
+
+import (
+	"cco_backend/catalogdiff"
+	"cco_backend/config"
+	"cco_backend/services"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	take := flag.String("take", "", "take a snapshot of the database and write it to this file instead of comparing")
+	asJSON := flag.Bool("json", false, "print the JSON report instead of the Markdown summary")
+	out := flag.String("out", "", "write report-<time>.json and report-<time>.md to this directory instead of printing")
+	flag.Parse()
+
+	if *take != "" {
+		config.ConnectDatabase()
+		snapshot, err := services.TakeCatalogSnapshot(context.Background())
+		if err != nil {
+			log.Fatalf("Error taking snapshot: %v", err)
+		}
+		if err := snapshot.Save(*take); err != nil {
+			log.Fatalf("Error saving snapshot: %v", err)
+		}
+		log.Printf("Saved snapshot of %d SKUs and %d prices to %s", len(snapshot.Skus), len(snapshot.Prices), *take)
+		return
+	}
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: catalogdiff [-json | -out dir] <before> <after>")
+		os.Exit(2)
+	}
+	before, err := catalogdiff.LoadSnapshot(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	after, err := catalogdiff.LoadSnapshot(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := catalogdiff.Diff(before, after)
+
+	switch {
+	case *out != "":
+		jsonPath, markdownPath, err := catalogdiff.WriteReport(*out, report)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote %s and %s", jsonPath, markdownPath)
+	case *asJSON:
+		data, err := report.JSON()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+	default:
+		fmt.Print(report.Markdown())
+	}
+}
@@ -0,0 +1,117 @@
+// Command skumatchfixture records the fixture BenchmarkIndexLookup and
+// BenchmarkLinearScan in resourceskus run on: the Resource SKUs list and a full crawl of
+// the price items, taken from the live APIs with the credentials and subscription the
+// importer uses.
+//
+//	go run ./cmd/skumatchfixture -record -dir /tmp/skumatch
+//	SKUMATCH_FIXTURE=/tmp/skumatch go test ./resourceskus -run '^$' -bench .
+//
+// Without SKUMATCH_FIXTURE the benchmarks run on a generated fixture.
+package main
+
+import (
+	"bufio"
+	"cco_backend/config"
+	"cco_backend/resourceskus"
+	"cco_backend/retailprices"
+	"cco_backend/utils"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The file names resourceskus/index_test.go reads
+const (
+	skusFile   = "skus.json"    // JSON array of resourceskus.ResourceSku
+	pricesFile = "prices.jsonl" // one retailprices.PriceItem per line
+)
+
+func main() {
+	dir := flag.String("dir", "skumatch-fixture", "fixture directory")
+	record := flag.Bool("record", false, "record the fixture from the live APIs")
+	flag.Parse()
+
+	if !*record {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := recordFixture(context.Background(), *dir); err != nil {
+		log.Fatalf("Error recording fixture: %v", err)
+	}
+}
+
+// recordFixture saves the Resource SKUs list of the first configured subscription and
+// the price items of the configured price import scope in the primary currency
+func recordFixture(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return err
+	}
+
+	skuCfg := config.LoadSkuImportConfig()
+	if len(skuCfg.SubscriptionIDs) == 0 {
+		return fmt.Errorf("set AZURE_SUBSCRIPTION_ID to record the Resource SKUs list")
+	}
+	skus, err := resourceskus.NewClient(utils.DefaultTokenProvider(), cloud.TokenScope).ListAll(ctx, resourceskus.Query{
+		Endpoint:       cloud.ResourceManagerEndpoint,
+		SubscriptionID: skuCfg.SubscriptionIDs[0],
+		APIVersion:     skuCfg.APIVersion,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(skus)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, skusFile), data, 0o644); err != nil {
+		return err
+	}
+	log.Printf("Recorded %d Resource SKU entries", len(skus))
+
+	scope := config.LoadPriceImportConfig()
+	query := retailprices.Query{
+		Endpoint:     cloud.PricingEndpoint,
+		APIVersion:   scope.APIVersion,
+		CurrencyCode: scope.PrimaryCurrency(),
+		Filter:       retailprices.In("serviceName", scope.Services...),
+	}
+
+	file, err := os.Create(filepath.Join(dir, pricesFile))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+
+	items := 0
+	pager := retailprices.NewClient().NewPager(ctx, query.URL())
+	for pager.Next() {
+		for _, item := range pager.Page().Items {
+			line, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := out.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("error writing %s: %w", pricesFile, err)
+			}
+			items++
+		}
+		if pager.PageNumber()%100 == 0 {
+			log.Printf("Recorded %d pages, %d price items", pager.PageNumber(), items)
+		}
+	}
+	if err := pager.Err(); err != nil {
+		return err
+	}
+	log.Printf("Recorded %d price items of %s", items, strings.Join(scope.Services, ", "))
+	return out.Flush()
+}
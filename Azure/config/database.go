@@ -20,6 +20,16 @@ func ConnectDatabase() {
 	}
 	fmt.Println("Database connected successfully!")
 
+	// Existing tables may hold duplicates that would block the unique natural keys
+	if err := prepareNaturalKeys(DB); err != nil {
+		log.Fatalf("Error preparing natural keys: %v", err)
+	}
+
+	// Capability columns written as text by earlier imports are converted in place
+	if err := convertSkuCapabilityColumns(DB); err != nil {
+		log.Fatalf("Error converting SKU columns: %v", err)
+	}
+
 	// Automigrate your models here
 	err = DB.AutoMigrate(
 		&models.Provider{},
@@ -27,9 +37,22 @@ func ConnectDatabase() {
 		&models.Sku{},   // Your Sku model
 		&models.Term{},  // Your Term model
 		&models.Price{}, // Your Price model (add all relevant models here)
+		&models.ImportCheckpoint{},
+		&models.ResourceSku{},
+		&models.ResourceSkuLocation{},
+		&models.ResourceSkuRestriction{},
+		&models.SkuCapability{},
+		&models.Subscription{},
+		&models.Meter{},
+		&models.Product{},
+		&models.SchemaMigration{},
 	)
 	if err != nil {
 		log.Fatalf("Error running migrations: %v", err)
 	}
+	// Prices classified before only VM prices were classified are reclassified once
+	if err := applyOnce(DB, "classify_vm_prices", classifyPrices); err != nil {
+		log.Fatalf("Error reclassifying prices: %v", err)
+	}
 	fmt.Println("Database migration completed successfully!")
 }
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PriceImportConfig selects which part of the Azure Retail Prices catalog is imported
+type PriceImportConfig struct {
+	Services      []string  // serviceName values, AZURE_PRICE_SERVICES
+	Regions       []string  // armRegionName values, AZURE_PRICE_REGIONS, all regions when empty
+	PriceTypes    []string  // priceType values, AZURE_PRICE_TYPES, all types when empty
+	Currencies    []string  // currencyCode values, AZURE_PRICE_CURRENCIES, the first one is primary
+	APIVersion    string    // api-version, AZURE_PRICE_API_VERSION
+	EffectiveFrom time.Time // lower effectiveStartDate bound, AZURE_PRICE_EFFECTIVE_FROM (YYYY-MM-DD)
+	EffectiveTo   time.Time // upper effectiveStartDate bound, AZURE_PRICE_EFFECTIVE_TO (YYYY-MM-DD)
+	ExtraFilter   string    // raw OData expression and-ed to the filter, AZURE_PRICE_FILTER
+}
+
+// LoadPriceImportConfig reads the price import scope from the environment. Lists are
+// comma separated; unset values fall back to the Virtual Machines catalog in USD.
+// Every currency is crawled separately since the API prices a query in one currency.
+func LoadPriceImportConfig() PriceImportConfig {
+	cfg := PriceImportConfig{
+		Services:    envList("AZURE_PRICE_SERVICES"),
+		Regions:     envList("AZURE_PRICE_REGIONS"),
+		PriceTypes:  envList("AZURE_PRICE_TYPES"),
+		Currencies:  envList("AZURE_PRICE_CURRENCIES"),
+		APIVersion:  strings.TrimSpace(os.Getenv("AZURE_PRICE_API_VERSION")),
+		ExtraFilter: strings.TrimSpace(os.Getenv("AZURE_PRICE_FILTER")),
+	}
+	if len(cfg.Services) == 0 {
+		cfg.Services = []string{"Virtual Machines"}
+	}
+	if len(cfg.Currencies) == 0 {
+		// AZURE_PRICE_CURRENCY is the older single-currency setting
+		cfg.Currencies = envList("AZURE_PRICE_CURRENCY")
+	}
+	if len(cfg.Currencies) == 0 {
+		cfg.Currencies = []string{"USD"}
+	}
+	for i, currency := range cfg.Currencies {
+		cfg.Currencies[i] = strings.ToUpper(currency)
+	}
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = "2023-01-01-preview"
+	}
+	cfg.EffectiveFrom = envDate("AZURE_PRICE_EFFECTIVE_FROM")
+	cfg.EffectiveTo = envDate("AZURE_PRICE_EFFECTIVE_TO")
+	return cfg
+}
+
+// envList splits a comma separated environment variable, dropping empty entries
+func envList(key string) []string {
+	var list []string
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// envDate parses a YYYY-MM-DD environment variable, returning the zero time when unset
+func envDate(key string) time.Time {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return time.Time{}
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s %q, expected YYYY-MM-DD", key, value)
+		return time.Time{}
+	}
+	return date
+}
+
+// PrimaryCurrency returns the currency whose pages also feed currency independent
+// tables such as SKUs
+func (c PriceImportConfig) PrimaryCurrency() string {
+	return c.Currencies[0]
+}
+
+// SkuImportConfig selects which Resource SKUs lists are imported
+type SkuImportConfig struct {
+	SubscriptionIDs []string // subscriptions the list is read with, AZURE_SUBSCRIPTION_IDS
+	Discover        bool     // list the subscriptions through ARM, AZURE_DISCOVER_SUBSCRIPTIONS
+	Location        string   // optional location filter, AZURE_SKU_LOCATION
+	APIVersion      string   // api-version, AZURE_SKU_API_VERSION
+}
+
+// LoadSkuImportConfig reads the Resource SKUs import settings from the environment.
+// AZURE_SUBSCRIPTION_ID is used when AZURE_SUBSCRIPTION_IDS is not set; without any
+// subscription configured the ones visible to the credentials are discovered.
+func LoadSkuImportConfig() SkuImportConfig {
+	cfg := SkuImportConfig{
+		SubscriptionIDs: envList("AZURE_SUBSCRIPTION_IDS"),
+		Location:        strings.ToLower(strings.TrimSpace(os.Getenv("AZURE_SKU_LOCATION"))),
+		APIVersion:      strings.TrimSpace(os.Getenv("AZURE_SKU_API_VERSION")),
+	}
+	if len(cfg.SubscriptionIDs) == 0 {
+		cfg.SubscriptionIDs = envList("AZURE_SUBSCRIPTION_ID")
+	}
+	discover, _ := strconv.ParseBool(os.Getenv("AZURE_DISCOVER_SUBSCRIPTIONS"))
+	cfg.Discover = discover || len(cfg.SubscriptionIDs) == 0
+	return cfg
+}
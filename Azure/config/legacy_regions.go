@@ -0,0 +1,71 @@
+package config
+
+// legacyRegion is the ARM name and cloud of a region stored under its price feed display
+// location
+type legacyRegion struct {
+	code  string
+	cloud string
+}
+
+// legacyRegionCodes maps the display locations of the Retail Prices API, which the
+// region import used as region codes before it keyed regions by armRegionName, to the
+// ARM names regions are stored under now. Locations without an ARM name, such as Global,
+// were and are stored as they are.
+var legacyRegionCodes = map[string]legacyRegion{
+	"AP East":          {"eastasia", "AzurePublic"},
+	"AP Southeast":     {"southeastasia", "AzurePublic"},
+	"AU Central":       {"australiacentral", "AzurePublic"},
+	"AU Central 2":     {"australiacentral2", "AzurePublic"},
+	"AU East":          {"australiaeast", "AzurePublic"},
+	"AU Southeast":     {"australiasoutheast", "AzurePublic"},
+	"BR South":         {"brazilsouth", "AzurePublic"},
+	"BR Southeast":     {"brazilsoutheast", "AzurePublic"},
+	"CA Central":       {"canadacentral", "AzurePublic"},
+	"CA East":          {"canadaeast", "AzurePublic"},
+	"CH North":         {"switzerlandnorth", "AzurePublic"},
+	"CH West":          {"switzerlandwest", "AzurePublic"},
+	"DE North":         {"germanynorth", "AzurePublic"},
+	"DE West Central":  {"germanywestcentral", "AzurePublic"},
+	"ES Central":       {"spaincentral", "AzurePublic"},
+	"EU North":         {"northeurope", "AzurePublic"},
+	"EU West":          {"westeurope", "AzurePublic"},
+	"FR Central":       {"francecentral", "AzurePublic"},
+	"FR South":         {"francesouth", "AzurePublic"},
+	"IL Central":       {"israelcentral", "AzurePublic"},
+	"IN Central":       {"centralindia", "AzurePublic"},
+	"IN South":         {"southindia", "AzurePublic"},
+	"IN West":          {"westindia", "AzurePublic"},
+	"IT North":         {"italynorth", "AzurePublic"},
+	"JA East":          {"japaneast", "AzurePublic"},
+	"JA West":          {"japanwest", "AzurePublic"},
+	"KR Central":       {"koreacentral", "AzurePublic"},
+	"KR South":         {"koreasouth", "AzurePublic"},
+	"MX Central":       {"mexicocentral", "AzurePublic"},
+	"NO East":          {"norwayeast", "AzurePublic"},
+	"NO West":          {"norwaywest", "AzurePublic"},
+	"NZ North":         {"newzealandnorth", "AzurePublic"},
+	"PL Central":       {"polandcentral", "AzurePublic"},
+	"QA Central":       {"qatarcentral", "AzurePublic"},
+	"SE Central":       {"swedencentral", "AzurePublic"},
+	"SE South":         {"swedensouth", "AzurePublic"},
+	"UAE Central":      {"uaecentral", "AzurePublic"},
+	"UAE North":        {"uaenorth", "AzurePublic"},
+	"UK South":         {"uksouth", "AzurePublic"},
+	"UK West":          {"ukwest", "AzurePublic"},
+	"US Central":       {"centralus", "AzurePublic"},
+	"US East":          {"eastus", "AzurePublic"},
+	"US East 2":        {"eastus2", "AzurePublic"},
+	"US North Central": {"northcentralus", "AzurePublic"},
+	"US South Central": {"southcentralus", "AzurePublic"},
+	"US West":          {"westus", "AzurePublic"},
+	"US West 2":        {"westus2", "AzurePublic"},
+	"US West 3":        {"westus3", "AzurePublic"},
+	"US West Central":  {"westcentralus", "AzurePublic"},
+	"ZA North":         {"southafricanorth", "AzurePublic"},
+	"ZA West":          {"southafricawest", "AzurePublic"},
+	"US DoD Central":   {"usdodcentral", "AzureUSGovernment"},
+	"US DoD East":      {"usdodeast", "AzureUSGovernment"},
+	"US Gov Arizona":   {"usgovarizona", "AzureUSGovernment"},
+	"US Gov Texas":     {"usgovtexas", "AzureUSGovernment"},
+	"US Gov Virginia":  {"usgovvirginia", "AzureUSGovernment"},
+}
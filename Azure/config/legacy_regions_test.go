@@ -0,0 +1,24 @@
+package config
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLegacyRegionCodes(t *testing.T) {
+	armName := regexp.MustCompile(`^[a-z0-9]{1,20}$`) // regions.region_code is size 20
+	clouds := map[string]bool{"AzurePublic": true, "AzureUSGovernment": true}
+	targets := map[string]string{}
+	for location, region := range legacyRegionCodes {
+		if !armName.MatchString(region.code) {
+			t.Errorf("%s maps to %q, not an ARM region name", location, region.code)
+		}
+		if !clouds[region.cloud] {
+			t.Errorf("%s maps to unknown cloud %q", location, region.cloud)
+		}
+		if other, ok := targets[region.code]; ok {
+			t.Errorf("%s and %s both map to %s", location, other, region.code)
+		}
+		targets[region.code] = location
+	}
+}
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cco_backend/models"
+	"cco_backend/retailprices"
+)
+
+// naturalKey is a unique index AutoMigrate creates on a table that may already hold
+// duplicates written by earlier, non-idempotent imports
+type naturalKey struct {
+	model    interface{}
+	table    string
+	primary  string
+	index    string
+	columns  []string
+	children []reference // rows moved to the kept row when a duplicate is removed
+}
+
+// reference is a column of another table holding the primary key of a natural key row
+type reference struct {
+	table  string
+	column string
+}
+
+// naturalKeys are cleaned up in this order, so the rows pointing at a removed duplicate
+// are moved to the kept row before their own table is deduplicated
+var naturalKeys = []naturalKey{
+	{&models.Region{}, "regions", "region_id", "idx_regions_key", []string{"region_code", "cloud"},
+		[]reference{{"skus", "region_id"}}},
+	{&models.Sku{}, "skus", "id", "idx_skus_key", []string{"sku_id_api", "region_id", `"type"`},
+		[]reference{{"prices", "sku_id"}, {"terms", "sku_id"}}},
+	{&models.Price{}, "prices", "price_id", "idx_prices_key", []string{"sku_id", "meter_id", "effective_date", "tier_minimum_units", "currency_code", "price_type", "reservation_term"},
+		[]reference{{"terms", "price_id"}, {"terms", "on_demand_price_id"}}},
+	{&models.Term{}, "terms", "offer_term_id", "idx_terms_key", []string{"price_id", "purchase_option", "lease_contract_length"}, nil},
+}
+
+// prepareNaturalKeys makes existing tables ready for their unique natural keys. It only
+// runs while one of the keys is missing or has other columns, or regions are still
+// stored under their display location, so once AutoMigrate has created the keys
+// startup does not scan the tables again. Columns that are part of a key are added
+// first and the existing keys are dropped, for AutoMigrate to build them again once the
+// rows are unique. Regions are renamed to their ARM names, then duplicates are merged
+// into the newest row: the rows pointing at a duplicate are moved to the kept row, so
+// the SKUs of a renamed region end up next to the ones imported under its ARM name and
+// are merged in turn, down to their prices and terms. Prices and terms that pointed at
+// a SKU or price that no longer exists are removed; the next import writes them again.
+// Removing rows needs MIGRATE_ALLOW_DELETES=true: without it a cleanup that would
+// remove any fails with the counts instead. Everything runs in one transaction, so a
+// failed or interrupted cleanup leaves the tables as they were. Tables that do not
+// exist yet are left alone.
+func prepareNaturalKeys(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Sku{}) {
+		return nil
+	}
+
+	var pending []string
+	for _, key := range naturalKeys {
+		if !migrator.HasTable(key.model) {
+			continue
+		}
+		ok, err := hasNaturalKey(db, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			pending = append(pending, key.index)
+		}
+	}
+	legacy, err := countLegacyRegions(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 && legacy == 0 {
+		return nil
+	}
+	log.Printf("Preparing natural keys %s, %d regions stored under their display location", strings.Join(pending, ", "), legacy)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		var removed removals
+		for _, key := range naturalKeys {
+			if !migrator.HasTable(key.model) {
+				continue
+			}
+			for _, column := range key.columns {
+				name := strings.Trim(column, `"`)
+				if !migrator.HasColumn(key.model, name) {
+					if err := migrator.AddColumn(key.model, name); err != nil {
+						return fmt.Errorf("error adding %s.%s: %w", key.table, name, err)
+					}
+				}
+			}
+			// Merging moves rows onto the keys of others, which the unique indexes
+			// would reject until the duplicates are gone
+			if migrator.HasIndex(key.model, key.index) {
+				if err := migrator.DropIndex(key.model, key.index); err != nil {
+					return fmt.Errorf("error dropping %s: %w", key.index, err)
+				}
+			}
+		}
+
+		if err := renameLegacyRegions(tx); err != nil {
+			return err
+		}
+
+		// Savings plan terms were written without a purchase option, which would keep
+		// them out of the unique key since NULLs never conflict
+		if migrator.HasTable(&models.Term{}) {
+			if err := tx.Exec(`UPDATE terms SET purchase_option = 'SavingsPlan' WHERE purchase_option IS NULL AND lease_contract_length IS NOT NULL`).Error; err != nil {
+				return fmt.Errorf("error backfilling term purchase options: %w", err)
+			}
+		}
+
+		// Prices were written without their price type and reservation term. The type
+		// is the one of their SKU; the 1 and 3 year reservation prices of a meter were
+		// written over each other, so which term a row holds is unknown and it is removed.
+		if migrator.HasTable(&models.Price{}) {
+			if err := tx.Exec(`UPDATE prices p SET price_type = s.type FROM skus s WHERE s.id = p.sku_id AND p.price_type <> s.type`).Error; err != nil {
+				return fmt.Errorf("error backfilling price types: %w", err)
+			}
+			result := tx.Exec(`DELETE FROM prices WHERE price_type = 'Reservation' AND reservation_term = ''`)
+			if result.Error != nil {
+				return fmt.Errorf("error removing reservation prices without a term: %w", result.Error)
+			}
+			removed.add(result.RowsAffected, "reservation prices without a term")
+		}
+
+		for _, key := range naturalKeys {
+			if !migrator.HasTable(key.model) {
+				continue
+			}
+			var (
+				orphans int64
+				err     error
+			)
+			switch key.table {
+			case "prices":
+				orphans, err = deleteOrphans(tx, "prices", "sku_id", "skus", "id")
+			case "terms":
+				orphans, err = deleteOrphans(tx, "terms", "price_id", "prices", "price_id")
+			}
+			if err != nil {
+				return err
+			}
+			removed.add(orphans, "orphaned "+key.table)
+			if err := moveChildrenOfDuplicates(tx, key); err != nil {
+				return err
+			}
+			duplicates, err := deleteDuplicates(tx, key)
+			if err != nil {
+				return err
+			}
+			removed.add(duplicates, "duplicate "+key.table)
+		}
+
+		if len(removed) > 0 {
+			if !deletesAllowed() {
+				return fmt.Errorf("preparing natural keys would remove %s; back up the database and start with MIGRATE_ALLOW_DELETES=true to remove them",
+					strings.Join(removed, ", "))
+			}
+			log.Printf("Removed %s", strings.Join(removed, ", "))
+		}
+		return nil
+	})
+}
+
+// removals describes the rows a migration step removed, e.g. "3 duplicate skus"
+type removals []string
+
+func (r *removals) add(count int64, what string) {
+	if count > 0 {
+		*r = append(*r, fmt.Sprintf("%d %s", count, what))
+	}
+}
+
+// deletesAllowed reports whether MIGRATE_ALLOW_DELETES lets startup migrations remove
+// rows. Without it a migration that would remove rows fails and changes nothing.
+func deletesAllowed() bool {
+	allowed, _ := strconv.ParseBool(os.Getenv("MIGRATE_ALLOW_DELETES"))
+	return allowed
+}
+
+// countLegacyRegions returns how many regions are stored under a display location
+func countLegacyRegions(db *gorm.DB) (int64, error) {
+	if !db.Migrator().HasTable(&models.Region{}) {
+		return 0, nil
+	}
+	codes := make([]string, 0, len(legacyRegionCodes))
+	for code := range legacyRegionCodes {
+		codes = append(codes, code)
+	}
+	var count int64
+	if err := db.Model(&models.Region{}).Where("region_code IN ?", codes).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("error counting legacy regions: %w", err)
+	}
+	return count, nil
+}
+
+// renameLegacyRegions gives the regions stored under a display location their ARM name
+// and cloud. A region that was imported under its ARM name too is then a duplicate,
+// merged like any other.
+func renameLegacyRegions(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable(&models.Region{}) {
+		return nil
+	}
+	codes := make([]string, 0, len(legacyRegionCodes))
+	for code := range legacyRegionCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	values := make([]string, 0, len(codes))
+	args := make([]interface{}, 0, 3*len(codes))
+	for _, code := range codes {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, code, legacyRegionCodes[code].code, legacyRegionCodes[code].cloud)
+	}
+	query := fmt.Sprintf(`UPDATE regions r SET region_code = m.code, cloud = m.cloud
+		FROM (VALUES %s) AS m(location, code, cloud) WHERE r.region_code = m.location`, strings.Join(values, ", "))
+	result := tx.Exec(query, args...)
+	if result.Error != nil {
+		return fmt.Errorf("error renaming legacy regions: %w", result.Error)
+	}
+	log.Printf("Renamed %d regions from their display location to their ARM name", result.RowsAffected)
+	return nil
+}
+
+// duplicatesOf selects the primary key of every row of key's table together with the
+// primary key of the row kept for its natural key, the newest one
+func duplicatesOf(key naturalKey) string {
+	return fmt.Sprintf("SELECT %s AS id, MAX(%s) OVER (PARTITION BY %s) AS keep_id FROM %s",
+		key.primary, key.primary, strings.Join(key.columns, ", "), key.table)
+}
+
+// moveChildrenOfDuplicates points the rows referencing a duplicate at the kept row
+func moveChildrenOfDuplicates(tx *gorm.DB, key naturalKey) error {
+	migrator := tx.Migrator()
+	for _, child := range key.children {
+		if !migrator.HasTable(child.table) || !migrator.HasColumn(child.table, child.column) {
+			continue
+		}
+		query := fmt.Sprintf(`UPDATE %s c SET %s = d.keep_id FROM (%s) d WHERE c.%s = d.id AND d.id <> d.keep_id`,
+			child.table, child.column, duplicatesOf(key), child.column)
+		result := tx.Exec(query)
+		if result.Error != nil {
+			return fmt.Errorf("error moving %s of duplicate %s: %w", child.table, key.table, result.Error)
+		}
+		log.Printf("Moved %d %s rows from duplicate %s to the kept row", result.RowsAffected, child.table, key.table)
+	}
+	return nil
+}
+
+// hasNaturalKey reports whether the unique index of key exists with exactly its columns
+func hasNaturalKey(db *gorm.DB, key naturalKey) (bool, error) {
+	indexes, err := db.Migrator().GetIndexes(key.model)
+	if err != nil {
+		return false, fmt.Errorf("error reading indexes of %s: %w", key.table, err)
+	}
+	for _, index := range indexes {
+		if index.Name() != key.index {
+			continue
+		}
+		unique, _ := index.Unique()
+		columns := index.Columns()
+		if !unique || len(columns) != len(key.columns) {
+			return false, nil
+		}
+		want := map[string]bool{}
+		for _, column := range key.columns {
+			want[strings.Trim(column, `"`)] = true
+		}
+		for _, column := range columns {
+			if !want[column] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// deleteDuplicates keeps the row with the highest primary key of every natural key, the
+// one moveChildrenOfDuplicates moved the references to. Rows whose key columns are NULL
+// in the same places are duplicates too.
+func deleteDuplicates(db *gorm.DB, key naturalKey) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT d.id FROM (%s) d WHERE d.id <> d.keep_id)",
+		key.table, key.primary, duplicatesOf(key))
+	result := db.Exec(query)
+	if result.Error != nil {
+		return 0, fmt.Errorf("error removing duplicate %s: %w", key.table, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// deleteOrphans removes rows whose reference no longer exists
+func deleteOrphans(db *gorm.DB, table, column, parent, parentKey string) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s NOT IN (SELECT %s FROM %s)", table, column, parentKey, parent)
+	result := db.Exec(query)
+	if result.Error != nil {
+		return 0, fmt.Errorf("error removing orphaned %s: %w", table, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// numericSkuColumns are SKU capability columns that used to hold the raw capability
+// string and now hold its typed value
+var numericSkuColumns = []struct {
+	column  string
+	sqlType string
+	pattern string
+}{
+	{"memory_gb", "numeric(10,2)", `^[0-9]+(\.[0-9]+)?$`},
+	{"max_network_interfaces", "bigint", `^[0-9]+$`},
+}
+
+// convertSkuCapabilityColumns changes the text capability columns of an existing skus
+// table to their numeric types, keeping the values that parse and clearing the rest.
+// AutoMigrate would alter the type with a plain cast, which fails on the empty strings
+// earlier imports wrote for missing capabilities.
+func convertSkuCapabilityColumns(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Sku{}) {
+		return nil
+	}
+	columnTypes, err := migrator.ColumnTypes(&models.Sku{})
+	if err != nil {
+		return fmt.Errorf("error reading skus columns: %w", err)
+	}
+	isText := map[string]bool{}
+	for _, columnType := range columnTypes {
+		switch strings.ToLower(columnType.DatabaseTypeName()) {
+		case "text", "varchar", "character varying":
+			isText[columnType.Name()] = true
+		}
+	}
+
+	for _, c := range numericSkuColumns {
+		if !isText[c.column] {
+			continue
+		}
+		query := fmt.Sprintf(`ALTER TABLE skus ALTER COLUMN %s TYPE %s USING CASE WHEN %s ~ '%s' THEN %s::%s END`,
+			c.column, c.sqlType, c.column, c.pattern, c.column, c.sqlType)
+		if err := db.Exec(query).Error; err != nil {
+			return fmt.Errorf("error converting skus.%s to %s: %w", c.column, c.sqlType, err)
+		}
+		log.Printf("Converted skus.%s to %s", c.column, c.sqlType)
+	}
+	return nil
+}
+
+// applyOnce runs the data migration name unless schema_migrations records that it
+// ran, and records it in the same transaction, so a failed migration runs again on the
+// next start
+func applyOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var applied int64
+		if err := tx.Model(&models.SchemaMigration{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+			return fmt.Errorf("error reading schema migrations: %w", err)
+		}
+		if applied > 0 {
+			return nil
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(&models.SchemaMigration{Name: name, AppliedAt: time.Now()}).Error; err != nil {
+			return fmt.Errorf("error recording schema migration %s: %w", name, err)
+		}
+		log.Printf("Applied schema migration %s", name)
+		return nil
+	})
+}
+
+// classifyPrices reclassifies the stored prices with retailprices.ClassifyVMPrice from
+// their meter and product, so prices of other services lose the VM classification they
+// were given. Prices whose meter was never imported keep their columns; the next import
+// writes them again.
+func classifyPrices(tx *gorm.DB) error {
+	type priceRow struct {
+		PriceID     int
+		PriceType   string
+		MeterName   string
+		SkuName     string
+		ProductName string
+		ServiceName string
+	}
+
+	updated, lastID := 0, 0
+	for {
+		var rows []priceRow
+		err := tx.Table("prices").
+			Select(`prices.price_id, prices.price_type, meters.meter_name, meters.sku_name,
+				COALESCE(products.product_name, '') AS product_name, COALESCE(products.service_name, '') AS service_name`).
+			Joins("JOIN meters ON meters.meter_id = prices.meter_id").
+			Joins("LEFT JOIN products ON products.product_id = meters.product_id").
+			Where("prices.price_id > ?", lastID).
+			Order("prices.price_id").
+			Limit(1000).
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("error loading prices to classify: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].PriceID
+
+		// Few distinct classes exist, so each batch is written with one update per class
+		byClass := map[retailprices.VMPriceClass][]int{}
+		for _, row := range rows {
+			class := retailprices.ClassifyVMPrice(retailprices.PriceItem{
+				Type:        row.PriceType,
+				MeterName:   row.MeterName,
+				SkuName:     row.SkuName,
+				ProductName: row.ProductName,
+				ServiceName: row.ServiceName,
+			})
+			byClass[class] = append(byClass[class], row.PriceID)
+		}
+		for class, ids := range byClass {
+			err := tx.Model(&models.Price{}).Where("price_id IN ?", ids).Updates(map[string]interface{}{
+				"operating_system":  class.OperatingSystem,
+				"license_model":     class.LicenseModel,
+				"priority":          class.Priority,
+				"dev_test_eligible": class.DevTestEligible,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("error classifying prices: %w", err)
+			}
+		}
+		updated += len(rows)
+	}
+	log.Printf("Reclassified %d prices", updated)
+	return nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger keeping every statement with its values inlined
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, strings.Join(strings.Fields(sql), " "))
+}
+
+// dryRun returns a Postgres session that builds statements without sending them
+func dryRun(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=dryrun"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
+
+func TestDeleteDuplicatesMatchesNullKeys(t *testing.T) {
+	var terms naturalKey
+	for _, key := range naturalKeys {
+		if key.table == "terms" {
+			terms = key
+		}
+	}
+
+	db, recorder := dryRun(t)
+	if _, err := deleteDuplicates(db, terms); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.statements) != 1 {
+		t.Fatalf("got statements %v", recorder.statements)
+	}
+	sql := recorder.statements[0]
+
+	// PARTITION BY groups NULLs together, where a.col = b.col never matches them
+	want := "DELETE FROM terms WHERE offer_term_id IN (SELECT d.id FROM (SELECT offer_term_id AS id, MAX(offer_term_id) OVER (PARTITION BY price_id, purchase_option, lease_contract_length) AS keep_id FROM terms) d WHERE d.id <> d.keep_id)"
+	if sql != want {
+		t.Errorf("got %s\nwant %s", sql, want)
+	}
+}
+
+func TestRemovals(t *testing.T) {
+	var removed removals
+	removed.add(0, "orphaned prices")
+	removed.add(3, "duplicate skus")
+	removed.add(1, "orphaned terms")
+	if got := strings.Join(removed, ", "); got != "3 duplicate skus, 1 orphaned terms" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDeletesAllowed(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "false": false, "no": false, "true": true, "1": true, "TRUE": true} {
+		t.Setenv("MIGRATE_ALLOW_DELETES", value)
+		if got := deletesAllowed(); got != want {
+			t.Errorf("MIGRATE_ALLOW_DELETES=%q: got %v, want %v", value, got, want)
+		}
+	}
+}
@@ -1,38 +1,73 @@
 package main
 
 import (
-	"log"
+	"cco_backend/catalogdiff"
 	"cco_backend/config"
 	"cco_backend/services"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	// Initialize the database
 	config.ConnectDatabase()
 
-	// Import data from Azure VM API
-	if err := services.ImportData(); err != nil {
+	// Ctrl-C or SIGTERM stops the import once the page being written is committed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// With CATALOG_REPORT_DIR set, the catalog is snapshotted before and after the
+	// import and a report of what changed is written next to the snapshots
+	reportDir := os.Getenv("CATALOG_REPORT_DIR")
+	var before *catalogdiff.Snapshot
+	if reportDir != "" {
+		var err error
+		if before, err = services.TakeCatalogSnapshot(ctx); err != nil {
+			log.Fatalf("Error taking catalog snapshot: %v", err)
+		}
+	}
+
+	// Crawl the Azure VM price feed once and fill the tables selected by IMPORT_SINKS
+	// (regions, skus, prices, terms); all of them when it is not set
+	if err := services.RunPipeline(ctx, services.SinksFromEnv()...); err != nil {
 		log.Fatalf("Error importing Azure VM data: %v", err)
 	} else {
 		log.Println("Azure VM data import completed successfully.")
 	}
 
-	// Import SKU data
-	// if err := services.ImportSkuData(); err != nil { 
-	// 	log.Fatalf("Error importing SKU data: %v", err)
-	// } else {
-	// 	log.Println("SKU data import completed successfully.")
-	// }
-
-	//Import terms data
-	// if err := services.ImportTermsData(); err != nil {
-	// 	log.Fatalf("Error importing terms data: %v", err)
-	// }
-
-	// Import prices data
-	// if err := services.ImportPricesData(); err != nil {
-	// 	log.Fatalf("Error importing prices data: %v", err)
-	// } else {
-	// 	log.Println("Prices data import completed successfully.")
-	// }
-}
\ No newline at end of file
+	if reportDir != "" {
+		if err := writeCatalogReport(ctx, reportDir, before); err != nil {
+			log.Fatalf("Error reporting catalog changes: %v", err)
+		}
+	}
+}
+
+// writeCatalogReport snapshots the imported catalog, stores both snapshots in dir so
+// they can be compared again with cmd/catalogdiff, and writes the diff report
+func writeCatalogReport(ctx context.Context, dir string, before *catalogdiff.Snapshot) error {
+	after, err := services.TakeCatalogSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, snapshot := range []*catalogdiff.Snapshot{before, after} {
+		if err := snapshot.Save(catalogdiff.SnapshotPath(dir, snapshot.TakenAt)); err != nil {
+			return err
+		}
+	}
+
+	report := catalogdiff.Diff(before, after)
+	jsonPath, markdownPath, err := catalogdiff.WriteReport(dir, report)
+	if err != nil {
+		return err
+	}
+	log.Printf("Catalog changes: %d new SKUs, %d retired SKUs, %d price increases, %d price decreases, %d new regions, %d new terms (%s, %s)",
+		len(report.NewSkus), len(report.RetiredSkus), len(report.PriceIncreases), len(report.PriceDecreases),
+		len(report.NewRegions), len(report.NewTerms), jsonPath, markdownPath)
+	return nil
+}
@@ -4,7 +4,8 @@ import "time"
 
 type Provider struct {
 	ProviderID   uint      `gorm:"primaryKey;autoIncrement"`
-	ProviderName string    `gorm:"size:50;not null"`
+	ProviderName string    `gorm:"size:50;not null;uniqueIndex:idx_providers_key"`
+	Cloud        string    `gorm:"size:30;not null;default:AzurePublic;uniqueIndex:idx_providers_key"` // cloud environment the provider row belongs to
 	CreatedDate  time.Time `gorm:"default:current_timestamp"`
 	ModifiedDate time.Time `gorm:"default:current_timestamp"`
 	DisableFlag  bool      `gorm:"default:false"`
@@ -15,12 +16,14 @@ func (Provider) TableName() string {
 }
 
 type Region struct {
-	RegionID    uint      `gorm:"primaryKey;autoIncrement"`
-	ProviderID  uint      `gorm:"not null"`
-	RegionCode  string    `gorm:"size:20;not null"`
-	CreatedDate time.Time `gorm:"default:current_timestamp"`
-	ModifiedDate time.Time `gorm:"default:current_timestamp"`
-	DisableFlag bool      `gorm:"default:false"`
+	RegionID     uint       `gorm:"primaryKey;autoIncrement"`
+	ProviderID   uint       `gorm:"not null"`
+	RegionCode   string     `gorm:"size:20;not null;uniqueIndex:idx_regions_key"`
+	Cloud        string     `gorm:"size:30;not null;default:AzurePublic;uniqueIndex:idx_regions_key"` // cloud environment the region was imported from
+	CreatedDate  time.Time  `gorm:"default:current_timestamp"`
+	ModifiedDate time.Time  `gorm:"default:current_timestamp"`
+	LastSeenAt   *time.Time `gorm:"index"`         // last import that listed the region
+	DisableFlag  bool       `gorm:"default:false"` // set when a complete import no longer lists the region
 }
 
 func (Region) TableName() string {
@@ -28,41 +31,53 @@ func (Region) TableName() string {
 }
 
 type Sku struct {
-    ID                  uint      `gorm:"primaryKey;column:id"` // Change to ID
-    RegionID            uint      `gorm:"column:region_id"`
-    Armskuname          string    `gorm:"column:armskuname"`
-    Name                string    `gorm:"column:name"`
-    UsageType           string    `gorm:"column:type"`
-    SkuCode             *string   `gorm:"column:sku_id_api"`
-    ProductName         *string   `gorm:"column:product_name"`
-    ProductFamily       *string   `gorm:"column:service_family"`
-    VCPU                int       `gorm:"column:v_cpus"`
-    Memory              string    `gorm:"column:memory_gb"`
-    CpuArchitectureType string    `gorm:"column:cpu_architecture_type"`
-    Network             string   `gorm:"column:max_network_interfaces"`
-    CreatedAt           time.Time `gorm:"column:created_at"`
-    UpdatedAt           time.Time `gorm:"column:modified_at"` 
-    DisableFlag         bool      `gorm:"column:disable_flag"`
+	ID                   uint       `gorm:"primaryKey;column:id"` // Change to ID
+	RegionID             uint       `gorm:"column:region_id;uniqueIndex:idx_skus_key"`
+	Armskuname           string     `gorm:"column:armskuname"`
+	Name                 string     `gorm:"column:name"`
+	UsageType            string     `gorm:"column:type;uniqueIndex:idx_skus_key"`
+	SkuCode              *string    `gorm:"column:sku_id_api;uniqueIndex:idx_skus_key"` // skuId of the price API; with region and type the natural key
+	ProductName          *string    `gorm:"column:product_name"`
+	ProductFamily        *string    `gorm:"column:service_family"`
+	VCPU                 int        `gorm:"column:v_cpus"`
+	MemoryGB             float64    `gorm:"column:memory_gb;type:numeric(10,2)"`
+	CpuArchitectureType  string     `gorm:"column:cpu_architecture_type"`
+	MaxNetworkInterfaces int        `gorm:"column:max_network_interfaces"`
+	ResourceSkuID        *uint      `gorm:"column:resource_sku_id;index"`      // catalog entry holding every capability
+	SizeSeries           string     `gorm:"column:size_series;size:100;index"` // Armskuname without the size, see resourceskus.SkuName
+	SizeFamily           string     `gorm:"column:size_family;size:10"`        // e.g. NC
+	SizeVCPUs            int        `gorm:"column:size_vcpus"`                 // vCPU count of the name
+	SizeFeatures         string     `gorm:"column:size_features;size:20"`      // additive feature letters, e.g. ads
+	SizeAccelerator      string     `gorm:"column:size_accelerator;size:20"`   // e.g. A100
+	SizeSuffix           string     `gorm:"column:size_suffix;size:20"`        // variant of the size, e.g. cc
+	SizeVersion          int        `gorm:"column:size_version"`               // generation, 1 without a version
+	CreatedAt            time.Time  `gorm:"column:created_at"`
+	UpdatedAt            time.Time  `gorm:"column:modified_at"`
+	LastSeenAt           *time.Time `gorm:"column:last_seen_at;index"` // last import that listed the SKU
+	DisableFlag          bool       `gorm:"column:disable_flag"`       // set when a complete import no longer lists the SKU
 }
 
 func (Sku) TableName() string {
-    return "skus"
+	return "skus"
 }
 
 // Term represents the terms table
 type Term struct {
-    OfferTermID         uint       `gorm:"primaryKey"`
-    OfferTermCode       *string    `gorm:"size:255"`
-    PriceID             uint       `gorm:"not null"`
-    SkuID               int        `gorm:"not null"`
-    PurchaseOption      *string    `gorm:"size:100"`
-    LeaseContractLength *string    `gorm:"size:50"`
-    DiscountedSku       *string    `gorm:"size:255"`
-    DiscountedRate      *float64   `gorm:"type:decimal(10,2)"`
-    OfferingClass       *string    `gorm:"size:50"`
-    CreatedDate         time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-    ModifiedDate        time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
-    DisableFlag         bool       `gorm:"default:false"`
+	OfferTermID         uint      `gorm:"primaryKey"`
+	OfferTermCode       *string   `gorm:"size:255"`
+	PriceID             uint      `gorm:"not null;uniqueIndex:idx_terms_key"`
+	SkuID               int       `gorm:"not null"`
+	PurchaseOption      *string   `gorm:"size:100;uniqueIndex:idx_terms_key"` // SavingsPlan or Reservation
+	LeaseContractLength *string   `gorm:"size:50;uniqueIndex:idx_terms_key"`
+	DiscountedSku       *string   `gorm:"size:255"`
+	DiscountedRate      *float64  `gorm:"type:numeric(15,6)"` // Equivalent hourly rate of the term
+	UnitPrice           *float64  `gorm:"type:numeric(15,6)"` // Unit price reported with a savings plan rate
+	OfferingClass       *string   `gorm:"size:50"`
+	OnDemandPriceID     *uint     `gorm:"index"`             // Consumption price the term is compared against
+	DiscountPercent     *float64  `gorm:"type:numeric(7,4)"` // Saving of DiscountedRate against the on-demand price
+	CreatedDate         time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	ModifiedDate        time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	DisableFlag         bool      `gorm:"default:false"`
 }
 
 // TableName specifies the table name for Term
@@ -71,17 +86,185 @@ func (Term) TableName() string {
 }
 
 type Price struct {
-	PriceID       int       `gorm:"primaryKey;autoIncrement"`    // Primary Key, Auto-incremented
-	SkuID         int       `gorm:"not null"`                    // Foreign key referencing sku table
-	RetailPrice   float64   `gorm:"type:numeric(15,6)"` // Retail price (numeric field with precision)
-	Unit          string    `gorm:"size:255;not null"`           // Unit of measurement
-	EffectiveDate time.Time `gorm:"not null"`                    // Effective date for the price
-	CreatedAt     time.Time `gorm:"default:current_timestamp"`   // Creation timestamp
-	ModifiedAt    time.Time `gorm:"default:current_timestamp"`   // Last modification timestamp
-	DisableFlag   bool      `gorm:"default:false"`               // Disable flag (defaults to false)
+	PriceID              int        `gorm:"primaryKey;autoIncrement"`                                         // Primary Key, Auto-incremented
+	SkuID                int        `gorm:"not null;uniqueIndex:idx_prices_key"`                              // Foreign key referencing sku table
+	MeterID              string     `gorm:"size:50;not null;default:'';uniqueIndex:idx_prices_key"`           // meterId of the price API
+	TierMinimumUnits     float64    `gorm:"type:numeric(18,4);not null;default:0;uniqueIndex:idx_prices_key"` // Lower bound of the price tier
+	RetailPrice          float64    `gorm:"type:numeric(15,6)"`                                               // Retail price (numeric field with precision)
+	Unit                 string     `gorm:"size:255;not null"`                                                // Unit of measurement
+	EffectiveDate        time.Time  `gorm:"not null;uniqueIndex:idx_prices_key"`                              // Effective date for the price
+	EffectiveEndDate     *time.Time `gorm:"index"`                                                            // End of the price's validity, set once a newer price supersedes it
+	CurrencyCode         string     `gorm:"size:3;not null;default:USD;index;uniqueIndex:idx_prices_key"`     // Currency the price is quoted in
+	BillingCurrency      string     `gorm:"size:3"`                                                           // Billing currency reported with the page
+	CreatedAt            time.Time  `gorm:"default:current_timestamp"`                                        // Creation timestamp
+	ModifiedAt           time.Time  `gorm:"default:current_timestamp"`                                        // Last modification timestamp
+	DisableFlag          bool       `gorm:"default:false"`                                                    // Set together with EffectiveEndDate when superseded
+	PriceType            string     `gorm:"size:30;not null;default:Consumption;uniqueIndex:idx_prices_key"`  // Consumption, Reservation or DevTestConsumption
+	ReservationTerm      string     `gorm:"size:20;not null;default:'';uniqueIndex:idx_prices_key"`           // 1 Year, 3 Years or 5 Years for reservation prices
+	UnitPrice            float64    `gorm:"type:numeric(15,6)"`                                               // Unit price reported next to the retail price
+	ProductID            string     `gorm:"size:50;index"`                                                    // productId of the price API
+	Location             string     `gorm:"size:100"`                                                         // Display name of the region, e.g. US East
+	IsPrimaryMeterRegion bool       // Whether this region is the primary one of a meter listed in several
+	OperatingSystem      string     `gorm:"size:20;not null;default:'';index"` // Linux or Windows, empty for reservations; all four are empty for other services than VMs
+	LicenseModel         string     `gorm:"size:20;not null;default:''"`       // LicenseIncluded when the Windows license is part of the price, else NotIncluded
+	Priority             string     `gorm:"size:20;not null;default:'';index"` // Regular, Spot or LowPriority
+	DevTestEligible      bool       `gorm:"not null;default:false"`            // Dev/test price, or a regular price Dev/Test subscriptions pay a dev/test rate for
 }
 
 // TableName specifies the table name for Price
 func (Price) TableName() string {
 	return "prices"
-}
\ No newline at end of file
+}
+
+// ImportCheckpoint records how far a paginated import run has progressed so that a
+// restarted run can continue from the last committed page
+type ImportCheckpoint struct {
+	CheckpointID uint      `gorm:"primaryKey;autoIncrement"`
+	ImportName   string    `gorm:"size:100;not null;uniqueIndex"` // importer the checkpoint belongs to
+	BaseURL      string    `gorm:"type:text;not null"`            // first page URL of the run
+	NextPageLink string    `gorm:"type:text"`                     // page to fetch next, empty once the run finished
+	PageCount    int       `gorm:"not null;default:0"`            // pages committed so far
+	CreatedDate  time.Time `gorm:"default:current_timestamp"`
+	ModifiedDate time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for ImportCheckpoint
+func (ImportCheckpoint) TableName() string {
+	return "import_checkpoints"
+}
+
+// ResourceSku is a SKU of the Microsoft.Compute/skus catalog. The API lists a SKU once
+// per location; those entries share one row here, while the parts that differ per
+// location and subscription are kept in ResourceSkuLocation and ResourceSkuRestriction,
+// its capabilities in SkuCapability.
+type ResourceSku struct {
+	ResourceSkuID uint      `gorm:"primaryKey;autoIncrement"`
+	ResourceType  string    `gorm:"size:100;not null;uniqueIndex:idx_resource_skus_key"`            // virtualMachines, disks, ...
+	Name          string    `gorm:"size:100;not null;uniqueIndex:idx_resource_skus_key"`            // e.g. Standard_D8s_v5
+	Tier          string    `gorm:"size:50;not null;default:'';uniqueIndex:idx_resource_skus_key"`  // e.g. Standard
+	Size          string    `gorm:"size:100;not null;default:'';uniqueIndex:idx_resource_skus_key"` // e.g. D8s_v5
+	Family        string    `gorm:"size:100"`                                                       // e.g. standardDSv5Family
+	Kind          string    `gorm:"size:50"`
+	CreatedDate   time.Time `gorm:"default:current_timestamp"`
+	ModifiedDate  time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for ResourceSku
+func (ResourceSku) TableName() string {
+	return "resource_skus"
+}
+
+// ResourceSkuLocation records that a SKU is offered in a location, and in which
+// availability zones, as seen by one subscription
+type ResourceSkuLocation struct {
+	ResourceSkuLocationID uint      `gorm:"primaryKey;autoIncrement"`
+	ResourceSkuID         uint      `gorm:"not null;uniqueIndex:idx_resource_sku_locations_key"`
+	SubscriptionID        string    `gorm:"size:36;not null;uniqueIndex:idx_resource_sku_locations_key"`
+	Location              string    `gorm:"size:50;not null;uniqueIndex:idx_resource_sku_locations_key"` // lower case ARM location name
+	Zones                 string    `gorm:"size:50"`                                                     // comma separated zone numbers
+	ZoneDetails           string    `gorm:"type:text"`                                                   // zone specific capabilities, JSON encoded
+	ExtendedLocations     string    `gorm:"type:text"`                                                   // comma separated edge zones
+	CreatedDate           time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for ResourceSkuLocation
+func (ResourceSkuLocation) TableName() string {
+	return "resource_sku_locations"
+}
+
+// ResourceSkuRestriction records why a SKU cannot be used by a subscription in a
+// location, or in some zones of it
+type ResourceSkuRestriction struct {
+	ResourceSkuRestrictionID uint      `gorm:"primaryKey;autoIncrement"`
+	ResourceSkuID            uint      `gorm:"not null;index"`
+	SubscriptionID           string    `gorm:"size:36;not null;index"`
+	Type                     string    `gorm:"size:20;not null"` // Location or Zone
+	Location                 string    `gorm:"size:50;not null"` // lower case ARM location name
+	Zones                    string    `gorm:"size:50"`          // comma separated zones of a Zone restriction
+	ReasonCode               string    `gorm:"size:50"`          // QuotaId or NotAvailableForSubscription
+	CreatedDate              time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for ResourceSkuRestriction
+func (ResourceSkuRestriction) TableName() string {
+	return "resource_sku_restrictions"
+}
+
+// SkuCapability is one capability of a ResourceSku as returned by the API, together with
+// its value parsed as a number or a bool when it is one
+type SkuCapability struct {
+	SkuCapabilityID uint      `gorm:"primaryKey;autoIncrement"`
+	ResourceSkuID   uint      `gorm:"not null;uniqueIndex:idx_sku_capabilities_key"`
+	Name            string    `gorm:"size:100;not null;uniqueIndex:idx_sku_capabilities_key"` // e.g. MemoryGB
+	Value           string    `gorm:"type:text;not null"`                                     // raw value, e.g. "32" or "V1,V2"
+	NumericValue    *float64  `gorm:"type:numeric(18,4)"`                                     // set when Value is a number
+	BoolValue       *bool     // set when Value is True or False
+	ModifiedDate    time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for SkuCapability
+func (SkuCapability) TableName() string {
+	return "sku_capabilities"
+}
+
+// Subscription is an Azure subscription whose Resource SKUs list has been imported
+type Subscription struct {
+	SubscriptionID string     `gorm:"primaryKey;size:36"`
+	DisplayName    string     `gorm:"size:255"`
+	State          string     `gorm:"size:20"` // Enabled, Warned, PastDue, Disabled or Deleted
+	Cloud          string     `gorm:"size:30;not null;default:AzurePublic"`
+	SkusImportedAt *time.Time // last successful Resource SKUs import
+	CreatedDate    time.Time  `gorm:"default:current_timestamp"`
+	ModifiedDate   time.Time  `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for Subscription
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// Meter is a meter of the Retail Prices API. A meter can be listed in several regions;
+// what differs per region is kept on its prices.
+type Meter struct {
+	MeterID       string    `gorm:"primaryKey;size:50"` // meterId of the price API
+	MeterName     string    `gorm:"size:255"`           // e.g. D8s v5 Spot
+	SkuName       string    `gorm:"size:255"`           // e.g. D8s v5 Spot
+	ProductID     string    `gorm:"size:50;index"`
+	UnitOfMeasure string    `gorm:"size:50"` // e.g. 1 Hour
+	CreatedDate   time.Time `gorm:"default:current_timestamp"`
+	ModifiedDate  time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for Meter
+func (Meter) TableName() string {
+	return "meters"
+}
+
+// Product is a product of the Retail Prices API, e.g. Virtual Machines Dsv5 Series
+// Windows, together with the service it belongs to
+type Product struct {
+	ProductID     string    `gorm:"primaryKey;size:50"` // productId of the price API
+	ProductName   string    `gorm:"size:255"`
+	ServiceName   string    `gorm:"size:100"` // e.g. Virtual Machines
+	ServiceID     string    `gorm:"size:50"`
+	ServiceFamily string    `gorm:"size:100"` // e.g. Compute
+	CreatedDate   time.Time `gorm:"default:current_timestamp"`
+	ModifiedDate  time.Time `gorm:"default:current_timestamp"`
+}
+
+// TableName specifies the table name for Product
+func (Product) TableName() string {
+	return "products"
+}
+
+// SchemaMigration records a one-off data migration that has been applied, so startup
+// does not run it again
+type SchemaMigration struct {
+	Name      string    `gorm:"primaryKey;size:100"` // e.g. classify_vm_prices
+	AppliedAt time.Time `gorm:"not null;default:current_timestamp"`
+}
+
+// TableName specifies the table name for SchemaMigration
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
@@ -0,0 +1,152 @@
+package resourceskus
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Names of commonly used capabilities
+const (
+	CapVCPUs                        = "vCPUs"
+	CapVCPUsAvailable               = "vCPUsAvailable"
+	CapMemoryGB                     = "MemoryGB"
+	CapGPUs                         = "GPUs"
+	CapMaxDataDiskCount             = "MaxDataDiskCount"
+	CapMaxNetworkInterfaces         = "MaxNetworkInterfaces"
+	CapPremiumIO                    = "PremiumIO"
+	CapAcceleratedNetworkingEnabled = "AcceleratedNetworkingEnabled"
+	CapEncryptionAtHostSupported    = "EncryptionAtHostSupported"
+	CapHyperVGenerations            = "HyperVGenerations"
+	CapCpuArchitectureType          = "CpuArchitectureType"
+	CapLowPriorityCapable           = "LowPriorityCapable"
+)
+
+// ParseCapabilityValue interprets a raw capability value. The API sends every value as
+// a string; numbers come back as number, "True"/"False" as bool, anything else (for
+// example "V1,V2" or "x64") only as the raw string.
+func ParseCapabilityValue(raw string) (number *float64, flag *bool) {
+	value := strings.TrimSpace(raw)
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return &f, nil
+	}
+	switch strings.ToLower(value) {
+	case "true":
+		b := true
+		return nil, &b
+	case "false":
+		b := false
+		return nil, &b
+	}
+	return nil, nil
+}
+
+// Capabilities indexes the capabilities of a SKU by name and offers typed accessors
+type Capabilities map[string]string
+
+// NewCapabilities indexes a capability list as returned by the API
+func NewCapabilities(list []Capability) Capabilities {
+	caps := make(Capabilities, len(list))
+	for _, capability := range list {
+		caps[capability.Name] = capability.Value
+	}
+	return caps
+}
+
+// String returns the raw value of a capability
+func (c Capabilities) String(name string) (string, bool) {
+	value, ok := c[name]
+	return value, ok
+}
+
+// Float returns a numeric capability; ok is false when it is missing or not a number
+func (c Capabilities) Float(name string) (value float64, ok bool) {
+	number, _ := ParseCapabilityValue(c[name])
+	if number == nil {
+		return 0, false
+	}
+	return *number, true
+}
+
+// Int returns a numeric capability truncated to an int
+func (c Capabilities) Int(name string) (int, bool) {
+	value, ok := c.Float(name)
+	return int(value), ok
+}
+
+// Bool returns a "True"/"False" capability; ok is false when it is missing or not a bool
+func (c Capabilities) Bool(name string) (value bool, ok bool) {
+	_, flag := ParseCapabilityValue(c[name])
+	if flag == nil {
+		return false, false
+	}
+	return *flag, true
+}
+
+// List returns a comma separated capability split into its values
+func (c Capabilities) List(name string) []string {
+	var values []string
+	for _, value := range strings.Split(c[name], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// VCPUs returns the number of virtual CPUs, 0 when unknown
+func (c Capabilities) VCPUs() int {
+	value, _ := c.Int(CapVCPUs)
+	return value
+}
+
+// MemoryGB returns the memory size in GiB, 0 when unknown
+func (c Capabilities) MemoryGB() float64 {
+	value, _ := c.Float(CapMemoryGB)
+	return value
+}
+
+// GPUs returns the number of GPUs, 0 when the SKU has none
+func (c Capabilities) GPUs() int {
+	value, _ := c.Int(CapGPUs)
+	return value
+}
+
+// MaxDataDiskCount returns the number of data disks that can be attached
+func (c Capabilities) MaxDataDiskCount() int {
+	value, _ := c.Int(CapMaxDataDiskCount)
+	return value
+}
+
+// MaxNetworkInterfaces returns the number of network interfaces that can be attached
+func (c Capabilities) MaxNetworkInterfaces() int {
+	value, _ := c.Int(CapMaxNetworkInterfaces)
+	return value
+}
+
+// PremiumIO reports whether premium storage disks are supported
+func (c Capabilities) PremiumIO() bool {
+	value, _ := c.Bool(CapPremiumIO)
+	return value
+}
+
+// AcceleratedNetworking reports whether accelerated networking is supported
+func (c Capabilities) AcceleratedNetworking() bool {
+	value, _ := c.Bool(CapAcceleratedNetworkingEnabled)
+	return value
+}
+
+// EncryptionAtHost reports whether encryption at host is supported
+func (c Capabilities) EncryptionAtHost() bool {
+	value, _ := c.Bool(CapEncryptionAtHostSupported)
+	return value
+}
+
+// HyperVGenerations returns the supported VM generations, e.g. [V1 V2]
+func (c Capabilities) HyperVGenerations() []string {
+	return c.List(CapHyperVGenerations)
+}
+
+// CpuArchitecture returns x64 or Arm64, empty when unknown
+func (c Capabilities) CpuArchitecture() string {
+	return c[CapCpuArchitectureType]
+}
@@ -0,0 +1,120 @@
+package resourceskus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCapabilityValue(t *testing.T) {
+	number := func(f float64) *float64 { return &f }
+	flag := func(b bool) *bool { return &b }
+
+	tests := []struct {
+		raw        string
+		wantNumber *float64
+		wantFlag   *bool
+	}{
+		{"4", number(4), nil},
+		{"0.75", number(0.75), nil},
+		{" 672 ", number(672), nil},
+		{"-1", number(-1), nil},
+		{"True", nil, flag(true)},
+		{"false", nil, flag(false)},
+		{" FALSE ", nil, flag(false)},
+		{"V1,V2", nil, nil},
+		{"x64", nil, nil},
+		{"Standard", nil, nil},
+		{"", nil, nil},
+	}
+
+	for _, tt := range tests {
+		gotNumber, gotFlag := ParseCapabilityValue(tt.raw)
+		if !reflect.DeepEqual(gotNumber, tt.wantNumber) || !reflect.DeepEqual(gotFlag, tt.wantFlag) {
+			t.Errorf("ParseCapabilityValue(%q) = %v, %v, want %v, %v", tt.raw, deref(gotNumber), deref(gotFlag), deref(tt.wantNumber), deref(tt.wantFlag))
+		}
+	}
+}
+
+func deref[T any](p *T) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := NewCapabilities([]Capability{
+		{Name: CapVCPUs, Value: "8"},
+		{Name: CapMemoryGB, Value: "0.75"},
+		{Name: CapMaxNetworkInterfaces, Value: "4"},
+		{Name: CapMaxDataDiskCount, Value: "16"},
+		{Name: CapPremiumIO, Value: "True"},
+		{Name: CapAcceleratedNetworkingEnabled, Value: "False"},
+		{Name: CapHyperVGenerations, Value: "V1, V2,"},
+		{Name: CapCpuArchitectureType, Value: "Arm64"},
+		{Name: CapEncryptionAtHostSupported, Value: "yes"},
+		{Name: CapVCPUsAvailable, Value: "6.9"},
+	})
+
+	numbers := []struct {
+		name  string
+		value float64
+		ok    bool
+	}{
+		{CapVCPUs, 8, true},
+		{CapMemoryGB, 0.75, true},
+		{CapPremiumIO, 0, false},           // a bool is not a number
+		{CapCpuArchitectureType, 0, false}, // free text
+		{CapGPUs, 0, false},                // missing
+	}
+	for _, tt := range numbers {
+		if value, ok := caps.Float(tt.name); value != tt.value || ok != tt.ok {
+			t.Errorf("Float(%s) = %v, %v, want %v, %v", tt.name, value, ok, tt.value, tt.ok)
+		}
+	}
+	if value, ok := caps.Int(CapVCPUsAvailable); value != 6 || !ok {
+		t.Errorf("Int(%s) = %v, %v, want the truncated 6", CapVCPUsAvailable, value, ok)
+	}
+
+	flags := []struct {
+		name  string
+		value bool
+		ok    bool
+	}{
+		{CapPremiumIO, true, true},
+		{CapAcceleratedNetworkingEnabled, false, true},
+		{CapEncryptionAtHostSupported, false, false}, // free text
+		{CapVCPUs, false, false},                     // a number is not a bool
+		{CapLowPriorityCapable, false, false},        // missing
+	}
+	for _, tt := range flags {
+		if value, ok := caps.Bool(tt.name); value != tt.value || ok != tt.ok {
+			t.Errorf("Bool(%s) = %v, %v, want %v, %v", tt.name, value, ok, tt.value, tt.ok)
+		}
+	}
+
+	if value, ok := caps.String(CapCpuArchitectureType); value != "Arm64" || !ok {
+		t.Errorf("String(%s) = %q, %v", CapCpuArchitectureType, value, ok)
+	}
+	if _, ok := caps.String(CapGPUs); ok {
+		t.Errorf("String(%s) found a missing capability", CapGPUs)
+	}
+
+	if caps.VCPUs() != 8 || caps.MemoryGB() != 0.75 || caps.GPUs() != 0 || caps.MaxDataDiskCount() != 16 || caps.MaxNetworkInterfaces() != 4 {
+		t.Errorf("got %d vCPUs, %v GB, %d GPUs, %d disks, %d NICs",
+			caps.VCPUs(), caps.MemoryGB(), caps.GPUs(), caps.MaxDataDiskCount(), caps.MaxNetworkInterfaces())
+	}
+	if !caps.PremiumIO() || caps.AcceleratedNetworking() || caps.EncryptionAtHost() {
+		t.Errorf("got premium IO %v, accelerated networking %v, encryption at host %v",
+			caps.PremiumIO(), caps.AcceleratedNetworking(), caps.EncryptionAtHost())
+	}
+	if got := caps.HyperVGenerations(); !reflect.DeepEqual(got, []string{"V1", "V2"}) {
+		t.Errorf("HyperVGenerations() = %v", got)
+	}
+	if caps.CpuArchitecture() != "Arm64" {
+		t.Errorf("CpuArchitecture() = %q", caps.CpuArchitecture())
+	}
+	if got := caps.List(CapGPUs); got != nil {
+		t.Errorf("List of a missing capability = %v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package resourceskus
+
+import (
+	"cco_backend/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultAPIVersion is the Resource SKUs API version used when a Query does not set one
+const DefaultAPIVersion = "2024-07-01"
+
+// Query describes a Resource SKUs API request for one subscription
+type Query struct {
+	Endpoint       string // ARM endpoint of the cloud, e.g. https://management.azure.com
+	SubscriptionID string
+	APIVersion     string // defaults to DefaultAPIVersion
+	Location       string // optional, scopes the list with $filter=location eq '...'
+}
+
+// URL returns the encoded URL of the first page of the query
+func (q Query) URL() string {
+	apiVersion := q.APIVersion
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+
+	u := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/skus?api-version=%s",
+		strings.TrimRight(q.Endpoint, "/"), url.PathEscape(q.SubscriptionID), url.QueryEscape(apiVersion))
+	if q.Location != "" {
+		filter := "location eq '" + strings.ReplaceAll(q.Location, "'", "''") + "'"
+		u += "&$filter=" + strings.ReplaceAll(url.QueryEscape(filter), "+", "%20")
+	}
+	return u
+}
+
+// Client fetches and decodes pages of the Resource SKUs API
+type Client struct {
+	// Fetch returns the raw body of an authenticated request
+	Fetch func(ctx context.Context, url string) ([]byte, error)
+}
+
+// NewClient returns a Client that authenticates with tokens for scope
+func NewClient(tokens *utils.TokenProvider, scope string) *Client {
+	return &Client{Fetch: func(ctx context.Context, url string) ([]byte, error) {
+		return utils.FetchBodyWithBearerToken(ctx, url, tokens, scope)
+	}}
+}
+
+// FetchPage fetches and decodes a single page. pageNum is only used for error reporting.
+func (c *Client) FetchPage(ctx context.Context, pageURL string, pageNum int) (*SkusPage, error) {
+	body, err := c.Fetch(ctx, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching SKU page %d: %w", pageNum, err)
+	}
+
+	var page SkusPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("error decoding SKU page %d (%s): %w", pageNum, pageURL, err)
+	}
+	return &page, nil
+}
+
+// ListAll fetches every page of the query by following nextLink and returns all SKUs
+func (c *Client) ListAll(ctx context.Context, q Query) ([]ResourceSku, error) {
+	var skus []ResourceSku
+	pageNum := 0
+	for next := q.URL(); next != ""; {
+		pageNum++
+		page, err := c.FetchPage(ctx, next, pageNum)
+		if err != nil {
+			return nil, err
+		}
+		skus = append(skus, page.Value...)
+		next = page.NextLink
+	}
+	return skus, nil
+}
@@ -0,0 +1,171 @@
+package resourceskus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestQueryURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        Query
+		wantPath     string
+		wantVersion  string
+		wantFilter   string
+		wantRawQuery string
+	}{
+		{
+			name:         "defaults",
+			query:        Query{Endpoint: "https://management.azure.com/", SubscriptionID: "0000-1111"},
+			wantPath:     "/subscriptions/0000-1111/providers/Microsoft.Compute/skus",
+			wantVersion:  DefaultAPIVersion,
+			wantRawQuery: "api-version=" + DefaultAPIVersion,
+		},
+		{
+			name:         "location filter",
+			query:        Query{Endpoint: "https://management.usgovcloudapi.net", SubscriptionID: "sub", APIVersion: "2021-07-01", Location: "usgovvirginia"},
+			wantPath:     "/subscriptions/sub/providers/Microsoft.Compute/skus",
+			wantVersion:  "2021-07-01",
+			wantFilter:   "location eq 'usgovvirginia'",
+			wantRawQuery: "api-version=2021-07-01&$filter=location%20eq%20%27usgovvirginia%27",
+		},
+		{
+			name:        "escaping",
+			query:       Query{Endpoint: "https://management.azure.com", SubscriptionID: "a/b c", APIVersion: "2024-07-01&x=1", Location: "o'brien & co+1"},
+			wantPath:    "/subscriptions/a/b c/providers/Microsoft.Compute/skus",
+			wantVersion: "2024-07-01&x=1",
+			wantFilter:  "location eq 'o''brien & co+1'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.query.URL()
+			u, err := url.Parse(raw)
+			if err != nil {
+				t.Fatalf("%s: %v", raw, err)
+			}
+			values := u.Query()
+			if u.Path != tt.wantPath || values.Get("api-version") != tt.wantVersion || values.Get("$filter") != tt.wantFilter {
+				t.Errorf("%s decodes to path %q, api-version %q, filter %q", raw, u.Path, values.Get("api-version"), values.Get("$filter"))
+			}
+			// A slash in the subscription stays part of its path segment
+			if !strings.HasPrefix(u.EscapedPath(), "/subscriptions/"+url.PathEscape(tt.query.SubscriptionID)+"/") {
+				t.Errorf("escaped path %q", u.EscapedPath())
+			}
+			if len(values) != 1+btoi(tt.wantFilter != "") {
+				t.Errorf("%s has parameters %v", raw, values)
+			}
+			if tt.wantRawQuery != "" && u.RawQuery != tt.wantRawQuery {
+				t.Errorf("query string %q, want %q", u.RawQuery, tt.wantRawQuery)
+			}
+			if strings.Contains(u.RawQuery, "+") {
+				t.Errorf("query string %q encodes spaces as +", u.RawQuery)
+			}
+		})
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// newSkuServer serves pages pages of two SKUs each, linking every page to the next
+// through nextLink, and records the URL of every request
+func newSkuServer(t *testing.T, pages int) (*httptest.Server, *[]string) {
+	var requested []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		n := 1
+		if token := r.URL.Query().Get("$skiptoken"); token != "" {
+			n, _ = strconv.Atoi(token)
+		}
+		if n < 1 || n > pages {
+			http.NotFound(w, r)
+			return
+		}
+		next := ""
+		if n < pages {
+			next = fmt.Sprintf("%s%s?api-version=%s&$skiptoken=%d", server.URL, r.URL.Path, DefaultAPIVersion, n+1)
+		}
+		fmt.Fprintf(w, `{"value":[{"resourceType":"virtualMachines","name":"Standard_D%d_v5"},{"resourceType":"disks","name":"Premium_LRS_%d"}],"nextLink":%q}`, n, n, next)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requested
+}
+
+func testClient(server *httptest.Server) *Client {
+	return &Client{Fetch: func(ctx context.Context, url string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}}
+}
+
+func TestListAllFollowsNextLink(t *testing.T) {
+	server, requested := newSkuServer(t, 3)
+
+	skus, err := testClient(server).ListAll(context.Background(), Query{Endpoint: server.URL, SubscriptionID: "sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sku := range skus {
+		names = append(names, sku.Name)
+	}
+	if fmt.Sprint(names) != "[Standard_D1_v5 Premium_LRS_1 Standard_D2_v5 Premium_LRS_2 Standard_D3_v5 Premium_LRS_3]" {
+		t.Errorf("got %v", names)
+	}
+	if len(*requested) != 3 || !strings.HasPrefix((*requested)[0], "/subscriptions/sub/providers/Microsoft.Compute/skus?api-version=") {
+		t.Errorf("requested %v", *requested)
+	}
+}
+
+func TestListAllStopsOnError(t *testing.T) {
+	// The second page links to a page the server does not have
+	server, _ := newSkuServer(t, 1)
+	client := testClient(server)
+	fetch := client.Fetch
+	client.Fetch = func(ctx context.Context, url string) ([]byte, error) {
+		body, err := fetch(ctx, url)
+		if err == nil && !strings.Contains(url, "$skiptoken") {
+			body = []byte(strings.Replace(string(body), `"nextLink":""`, `"nextLink":"`+server.URL+`/missing?$skiptoken=9"`, 1))
+		}
+		return body, err
+	}
+
+	_, err := client.ListAll(context.Background(), Query{Endpoint: server.URL, SubscriptionID: "sub"})
+	if err == nil || !strings.Contains(err.Error(), "error fetching SKU page 2") {
+		t.Errorf("got %v, want the error of page 2", err)
+	}
+}
+
+func TestFetchPageRejectsInvalidJSON(t *testing.T) {
+	client := &Client{Fetch: func(ctx context.Context, url string) ([]byte, error) {
+		return []byte(`{"value":[`), nil
+	}}
+	if _, err := client.FetchPage(context.Background(), "https://example.com/skus", 4); err == nil || !strings.Contains(err.Error(), "error decoding SKU page 4") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package resourceskus
+
+import "strings"
+
+// Index looks SKUs up by name and location in constant time. The API lists a SKU once
+// per location, and capabilities can differ between those entries, so the location
+// specific entry is preferred.
+type Index struct {
+	byName map[string]*indexEntry
+}
+
+type indexEntry struct {
+	first      *ResourceSku            // entry returned when the location is not listed
+	byLocation map[string]*ResourceSku // lower case location to entry
+}
+
+// NewIndex indexes skus. Entries are referenced, not copied, so skus must not be
+// modified while the index is in use.
+func NewIndex(skus []ResourceSku) *Index {
+	idx := &Index{byName: make(map[string]*indexEntry, len(skus))}
+	for i := range skus {
+		sku := &skus[i]
+		entry, ok := idx.byName[sku.Name]
+		if !ok {
+			entry = &indexEntry{first: sku, byLocation: map[string]*ResourceSku{}}
+			idx.byName[sku.Name] = entry
+		}
+		for _, location := range sku.Locations {
+			location = strings.ToLower(location)
+			if _, ok := entry.byLocation[location]; !ok {
+				entry.byLocation[location] = sku
+			}
+		}
+	}
+	return idx
+}
+
+// Lookup returns the entry of name in location, or any entry of name when the SKU is
+// not listed in that location
+func (idx *Index) Lookup(name, location string) (*ResourceSku, bool) {
+	entry, ok := idx.byName[name]
+	if !ok {
+		return nil, false
+	}
+	if sku, ok := entry.byLocation[strings.ToLower(location)]; ok {
+		return sku, true
+	}
+	return entry.first, true
+}
+
+// Len returns the number of distinct SKU names in the index
+func (idx *Index) Len() int {
+	return len(idx.byName)
+}
@@ -0,0 +1,178 @@
+package resourceskus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// matchItem is the part of a price item the SKU sink matches on
+type matchItem struct {
+	ArmSkuName    string `json:"armSkuName"`
+	ArmRegionName string `json:"armRegionName"`
+}
+
+// linearLookup is the matching the SKU import did before Index: a scan of the whole
+// list for every item, preferring the entry of the item's location like Index.Lookup
+func linearLookup(skus []ResourceSku, name, location string) (*ResourceSku, bool) {
+	var first *ResourceSku
+	for i := range skus {
+		if skus[i].Name != name {
+			continue
+		}
+		if first == nil {
+			first = &skus[i]
+		}
+		for _, l := range skus[i].Locations {
+			if strings.EqualFold(l, location) {
+				return &skus[i], true
+			}
+		}
+	}
+	return first, first != nil
+}
+
+func TestIndexLookup(t *testing.T) {
+	skus := []ResourceSku{
+		{Name: "Standard_D2s_v5", Locations: []string{"eastus"}, Tier: "first"},
+		{Name: "Standard_D2s_v5", Locations: []string{"WestEurope"}, Tier: "westeurope"},
+		{Name: "Standard_E4s_v5", Locations: []string{"eastus"}},
+	}
+	idx := NewIndex(skus)
+
+	tests := []struct {
+		name, location string
+		wantTier       string
+		wantOK         bool
+	}{
+		{"Standard_D2s_v5", "westeurope", "westeurope", true},
+		{"Standard_D2s_v5", "eastus", "first", true},
+		{"Standard_D2s_v5", "japaneast", "first", true}, // not listed there, any entry
+		{"Standard_E4s_v5", "eastus", "", true},
+		{"Standard_F2s_v2", "eastus", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := idx.Lookup(tt.name, tt.location)
+		linear, linearOK := linearLookup(skus, tt.name, tt.location)
+		if ok != tt.wantOK || linearOK != tt.wantOK {
+			t.Errorf("Lookup(%s, %s) ok = %v, linear %v, want %v", tt.name, tt.location, ok, linearOK, tt.wantOK)
+			continue
+		}
+		if ok && (got.Tier != tt.wantTier || got != linear) {
+			t.Errorf("Lookup(%s, %s) = %q, linear %q, want %q", tt.name, tt.location, got.Tier, linear.Tier, tt.wantTier)
+		}
+	}
+	if idx.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", idx.Len())
+	}
+}
+
+// generateMatchFixture builds a fixture shaped like the live one: sizes listed once per
+// location in most of the regions, and per listed location a few price items (Linux,
+// Windows, spot, ...) plus items of sizes and regions the list does not have
+func generateMatchFixture(sizes, regions int) ([]ResourceSku, []matchItem) {
+	var skus []ResourceSku
+	var items []matchItem
+	for s := 0; s < sizes; s++ {
+		name := fmt.Sprintf("Standard_D%ds_v%d", s/5+1, s%5+2)
+		for r := 0; r < regions; r++ {
+			location := fmt.Sprintf("region%02d", r)
+			if (s+r)%4 == 0 {
+				// Not offered here, but priced: matched to any entry of the size
+				items = append(items, matchItem{ArmSkuName: name, ArmRegionName: location})
+				continue
+			}
+			skus = append(skus, ResourceSku{ResourceType: "virtualMachines", Name: name, Locations: []string{location}})
+			for i := 0; i < 3; i++ {
+				items = append(items, matchItem{ArmSkuName: name, ArmRegionName: location})
+			}
+		}
+		items = append(items, matchItem{ArmSkuName: name + "_Promo", ArmRegionName: "region00"})
+	}
+	return skus, items
+}
+
+func TestIndexMatchesLinearLookup(t *testing.T) {
+	skus, items := generateMatchFixture(40, 12)
+	idx := NewIndex(skus)
+	for _, item := range items {
+		got, ok := idx.Lookup(item.ArmSkuName, item.ArmRegionName)
+		want, wantOK := linearLookup(skus, item.ArmSkuName, item.ArmRegionName)
+		if got != want || ok != wantOK {
+			t.Fatalf("Lookup(%s, %s) differs from the linear match", item.ArmSkuName, item.ArmRegionName)
+		}
+	}
+}
+
+// loadMatchFixture reads the fixture recorded by cmd/skumatchfixture from the directory
+// in SKUMATCH_FIXTURE, or generates one when it is not set
+func loadMatchFixture(b *testing.B) ([]ResourceSku, []matchItem) {
+	dir := os.Getenv("SKUMATCH_FIXTURE")
+	if dir == "" {
+		return generateMatchFixture(300, 40)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "skus.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var all []ResourceSku
+	if err := json.Unmarshal(data, &all); err != nil {
+		b.Fatalf("error decoding skus.json: %v", err)
+	}
+	var skus []ResourceSku
+	for _, sku := range all {
+		if sku.ResourceType == "virtualMachines" {
+			skus = append(skus, sku)
+		}
+	}
+
+	file, err := os.Open(filepath.Join(dir, "prices.jsonl"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	var items []matchItem
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1<<20), 1<<24)
+	for scanner.Scan() {
+		var item matchItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			b.Fatalf("error decoding prices.jsonl line %d: %v", len(items)+1, err)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		b.Fatal(err)
+	}
+	return skus, items
+}
+
+// BenchmarkIndexLookup matches every price item of the fixture by name and region,
+// including building the index, as the SKU sink does
+func BenchmarkIndexLookup(b *testing.B) {
+	skus, items := loadMatchFixture(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx := NewIndex(skus)
+		for _, item := range items {
+			idx.Lookup(item.ArmSkuName, item.ArmRegionName)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*max(len(items), 1)), "ns/item")
+}
+
+// BenchmarkLinearScan does the same matching with a scan of the SKU list per item
+func BenchmarkLinearScan(b *testing.B) {
+	skus, items := loadMatchFixture(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, item := range items {
+			linearLookup(skus, item.ArmSkuName, item.ArmRegionName)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*max(len(items), 1)), "ns/item")
+}
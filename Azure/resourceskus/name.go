@@ -0,0 +1,192 @@
+package resourceskus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Additive features of a VM size name, the lower case letters after the vCPU count
+const (
+	FeatureAMD             = 'a'
+	FeatureBlockStorage    = 'b' // block storage performance
+	FeatureConfidential    = 'c'
+	FeatureLocalDisk       = 'd'
+	FeatureTDX             = 'e' // confidential with Intel TDX
+	FeatureIsolated        = 'i'
+	FeatureLowMemory       = 'l'
+	FeatureMemoryIntensive = 'm'
+	FeatureARM             = 'p'
+	FeatureRDMA            = 'r'
+	FeaturePremiumStorage  = 's'
+	FeatureTinyMemory      = 't'
+)
+
+// sizeSpec matches the part of a VM size name after the tier, e.g. NC24ads or E4-2s
+var sizeSpec = regexp.MustCompile(`^([A-Z]+)(\d+)(?:-(\d+))?([a-z]*)$`)
+
+// versionPart matches the generation suffix, e.g. v5
+var versionPart = regexp.MustCompile(`^v(\d+)$`)
+
+// nameSuffixes are lower case name parts that mark a variant of a size rather than an
+// accelerator, e.g. cc in Standard_DC4as_cc_v5 for confidential child capable sizes
+var nameSuffixes = map[string]bool{
+	"cc": true,
+}
+
+// SkuName is an ARM VM size name split into its parts following the Azure naming
+// convention [Tier]_[Family][vCPUs][-constrained vCPUs][Features]_[Accelerator]_[Suffix]_[Version],
+// e.g. Standard_NC24ads_A100_v4 is tier Standard, family NC, 24 vCPUs, features ads,
+// accelerator A100 and version 4, and Standard_DC4as_cc_v5 has the suffix cc. Some
+// older sizes give the constrained vCPUs as a part of their own after the features,
+// e.g. Standard_M416s_8_v2.
+type SkuName struct {
+	Tier             string // Standard or Basic
+	Family           string // family letter and subfamily letters, e.g. D, NC or DS
+	Size             int    // vCPUs of the size
+	ConstrainedVCPUs int    // vCPUs available on a constrained core size, 0 otherwise
+	Features         string // additive feature letters, e.g. ads
+	Accelerator      string // e.g. A100 or T4, empty for sizes without one
+	Suffix           string // variant of the size, e.g. cc for confidential child capable
+	Version          int    // generation, 1 when the name has no version
+	Promo            bool   // promotional variant of the size, named with a _Promo suffix
+
+	constrainedPart bool // ConstrainedVCPUs is written as its own part, e.g. M416s_8_v2
+}
+
+// ParseSkuName splits an ARM VM size name such as Standard_D4ads_v5
+func ParseSkuName(name string) (SkuName, error) {
+	parts := strings.Split(strings.TrimSpace(name), "_")
+	if len(parts) < 2 || parts[0] == "" {
+		return SkuName{}, fmt.Errorf("invalid VM size name %q: no tier", name)
+	}
+
+	match := sizeSpec.FindStringSubmatch(parts[1])
+	if match == nil {
+		return SkuName{}, fmt.Errorf("invalid VM size name %q: cannot parse %q", name, parts[1])
+	}
+	parsed := SkuName{Tier: parts[0], Family: match[1], Features: match[4], Version: 1}
+	parsed.Size, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		parsed.ConstrainedVCPUs, _ = strconv.Atoi(match[3])
+	}
+
+	for i, part := range parts[2:] {
+		if n, err := strconv.Atoi(part); err == nil {
+			// Only right after the size, and only once
+			if i > 0 || n <= 0 || parsed.ConstrainedVCPUs > 0 {
+				return SkuName{}, fmt.Errorf("invalid VM size name %q: unexpected %q", name, part)
+			}
+			parsed.ConstrainedVCPUs = n
+			parsed.constrainedPart = true
+			continue
+		}
+		if m := versionPart.FindStringSubmatch(part); m != nil {
+			parsed.Version, _ = strconv.Atoi(m[1])
+			continue
+		}
+		switch {
+		case strings.EqualFold(part, "Promo"):
+			parsed.Promo = true
+		case nameSuffixes[part] && parsed.Suffix == "":
+			parsed.Suffix = part
+		case part != "" && parsed.Accelerator == "" && parsed.Suffix == "":
+			parsed.Accelerator = part
+		default:
+			return SkuName{}, fmt.Errorf("invalid VM size name %q: unexpected %q", name, part)
+		}
+	}
+	return parsed, nil
+}
+
+// String returns the ARM name, so parsing and formatting a name gives it back
+func (n SkuName) String() string {
+	return n.format(true)
+}
+
+// Series returns the name without its size, e.g. Standard_NC_ads_A100_v4. Sizes of one
+// series differ only in their vCPU count.
+func (n SkuName) Series() string {
+	return n.format(false)
+}
+
+func (n SkuName) format(withSize bool) string {
+	var b strings.Builder
+	b.WriteString(n.Tier + "_" + n.Family)
+	if withSize {
+		b.WriteString(strconv.Itoa(n.Size))
+		if n.ConstrainedVCPUs > 0 && !n.constrainedPart {
+			b.WriteString("-" + strconv.Itoa(n.ConstrainedVCPUs))
+		}
+		b.WriteString(n.Features)
+		if n.ConstrainedVCPUs > 0 && n.constrainedPart {
+			b.WriteString("_" + strconv.Itoa(n.ConstrainedVCPUs))
+		}
+	} else if n.Features != "" {
+		// The separator keeps the family apart from the features, e.g. NC_ads
+		b.WriteString("_" + n.Features)
+	}
+	if n.Accelerator != "" {
+		b.WriteString("_" + n.Accelerator)
+	}
+	if n.Suffix != "" {
+		b.WriteString("_" + n.Suffix)
+	}
+	if n.Version > 1 {
+		b.WriteString("_v" + strconv.Itoa(n.Version))
+	}
+	if n.Promo {
+		b.WriteString("_Promo")
+	}
+	return b.String()
+}
+
+// Has reports whether the name carries an additive feature, e.g. FeatureAMD
+func (n SkuName) Has(feature rune) bool {
+	return strings.ContainsRune(n.Features, feature)
+}
+
+// Shorthands for the common features
+func (n SkuName) AMD() bool             { return n.Has(FeatureAMD) }
+func (n SkuName) LocalDisk() bool       { return n.Has(FeatureLocalDisk) }
+func (n SkuName) PremiumStorage() bool  { return n.Has(FeaturePremiumStorage) }
+func (n SkuName) ARM() bool             { return n.Has(FeatureARM) }
+func (n SkuName) LowMemory() bool       { return n.Has(FeatureLowMemory) }
+func (n SkuName) Isolated() bool        { return n.Has(FeatureIsolated) }
+func (n SkuName) MemoryIntensive() bool { return n.Has(FeatureMemoryIntensive) }
+
+// SameSeries reports whether other is a size of the same series. Constrained core
+// sizes belong to the series of their full size.
+func (n SkuName) SameSeries(other SkuName) bool {
+	return n.Series() == other.Series()
+}
+
+// NextSize returns the smallest size of n's series among candidates that has more vCPUs
+// than n, or the largest one with fewer when down is set. Constrained core sizes are
+// skipped since they cost the same as their full size.
+func NextSize(n SkuName, candidates []SkuName, down bool) (SkuName, bool) {
+	var sizes []SkuName
+	for _, candidate := range candidates {
+		if candidate.ConstrainedVCPUs == 0 && n.SameSeries(candidate) {
+			sizes = append(sizes, candidate)
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].Size < sizes[j].Size })
+
+	if down {
+		for i := len(sizes) - 1; i >= 0; i-- {
+			if sizes[i].Size < n.Size {
+				return sizes[i], true
+			}
+		}
+		return SkuName{}, false
+	}
+	for _, size := range sizes {
+		if size.Size > n.Size {
+			return size, true
+		}
+	}
+	return SkuName{}, false
+}
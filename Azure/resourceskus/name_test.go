@@ -0,0 +1,106 @@
+package resourceskus
+
+import "testing"
+
+func TestParseSkuName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   SkuName
+		series string
+	}{
+		{
+			"Standard_NC24ads_A100_v4",
+			SkuName{Tier: "Standard", Family: "NC", Size: 24, Features: "ads", Accelerator: "A100", Version: 4},
+			"Standard_NC_ads_A100_v4",
+		},
+		{
+			"Standard_DC4as_cc_v5",
+			SkuName{Tier: "Standard", Family: "DC", Size: 4, Features: "as", Suffix: "cc", Version: 5},
+			"Standard_DC_as_cc_v5",
+		},
+		{
+			"Standard_M416ms_v2",
+			SkuName{Tier: "Standard", Family: "M", Size: 416, Features: "ms", Version: 2},
+			"Standard_M_ms_v2",
+		},
+		{
+			"Standard_E104i_v5",
+			SkuName{Tier: "Standard", Family: "E", Size: 104, Features: "i", Version: 5},
+			"Standard_E_i_v5",
+		},
+		{
+			"Basic_A0",
+			SkuName{Tier: "Basic", Family: "A", Size: 0, Version: 1},
+			"Basic_A",
+		},
+		{
+			"Standard_E4-2ds_v5",
+			SkuName{Tier: "Standard", Family: "E", Size: 4, ConstrainedVCPUs: 2, Features: "ds", Version: 5},
+			"Standard_E_ds_v5",
+		},
+		{
+			"Standard_M416s_8_v2",
+			SkuName{Tier: "Standard", Family: "M", Size: 416, ConstrainedVCPUs: 8, Features: "s", Version: 2, constrainedPart: true},
+			"Standard_M_s_v2",
+		},
+		{
+			"Standard_M208ms_4_v2_Promo",
+			SkuName{Tier: "Standard", Family: "M", Size: 208, ConstrainedVCPUs: 4, Features: "ms", Version: 2, Promo: true, constrainedPart: true},
+			"Standard_M_ms_v2_Promo",
+		},
+		{
+			"Standard_DS3_v2_Promo",
+			SkuName{Tier: "Standard", Family: "DS", Size: 3, Version: 2, Promo: true},
+			"Standard_DS_v2_Promo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSkuName(tt.name)
+			if err != nil {
+				t.Fatalf("ParseSkuName(%q): %v", tt.name, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSkuName(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+			if got.String() != tt.name {
+				t.Errorf("String() = %q, want %q", got.String(), tt.name)
+			}
+			if got.Series() != tt.series {
+				t.Errorf("Series() = %q, want %q", got.Series(), tt.series)
+			}
+		})
+	}
+}
+
+func TestParseSkuNameErrors(t *testing.T) {
+	for _, name := range []string{"", "Standard", "Standard_", "Standard_d4s_v5", "Standard_D4s_A100_T4_v5", "Standard_D4s_cc_A100_v5",
+		"Standard_E4-2ds_2_v5", "Standard_M416s_0_v2", "Standard_NC24ads_A100_8_v4"} {
+		if got, err := ParseSkuName(name); err == nil {
+			t.Errorf("ParseSkuName(%q) = %+v, want an error", name, got)
+		}
+	}
+}
+
+func TestNextSize(t *testing.T) {
+	var candidates []SkuName
+	for _, name := range []string{"Standard_D2s_v5", "Standard_D4s_v5", "Standard_D8s_v5", "Standard_D4ds_v5", "Standard_D16s_v4"} {
+		parsed, err := ParseSkuName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates = append(candidates, parsed)
+	}
+	current, _ := ParseSkuName("Standard_D4s_v5")
+
+	if up, ok := NextSize(current, candidates, false); !ok || up.String() != "Standard_D8s_v5" {
+		t.Errorf("next size up = %s, %v", up, ok)
+	}
+	if down, ok := NextSize(current, candidates, true); !ok || down.String() != "Standard_D2s_v5" {
+		t.Errorf("next size down = %s, %v", down, ok)
+	}
+	largest, _ := ParseSkuName("Standard_D8s_v5")
+	if up, ok := NextSize(largest, candidates, false); ok {
+		t.Errorf("expected no size above %s, got %s", largest, up)
+	}
+}
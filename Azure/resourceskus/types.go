@@ -0,0 +1,58 @@
+package resourceskus
+
+// SkusPage is one page of the Microsoft.Compute/skus (Resource SKUs) API
+type SkusPage struct {
+	Value    []ResourceSku `json:"value"`
+	NextLink string        `json:"nextLink"`
+}
+
+// ResourceSku is a single entry of the Resource SKUs API. The API returns one entry per
+// SKU and location for virtual machines; the location specific parts are LocationInfo
+// and Restrictions, which also depend on the subscription the list was read with.
+type ResourceSku struct {
+	ResourceType string         `json:"resourceType"`
+	Name         string         `json:"name"`
+	Tier         string         `json:"tier"`
+	Size         string         `json:"size"`
+	Family       string         `json:"family"`
+	Kind         string         `json:"kind"`
+	Locations    []string       `json:"locations"`
+	LocationInfo []LocationInfo `json:"locationInfo"`
+	Capabilities []Capability   `json:"capabilities"`
+	Restrictions []Restriction  `json:"restrictions"`
+}
+
+// LocationInfo lists the availability zones a SKU is offered in within one location
+type LocationInfo struct {
+	Location          string       `json:"location"`
+	Zones             []string     `json:"zones"`
+	ZoneDetails       []ZoneDetail `json:"zoneDetails"`
+	ExtendedLocations []string     `json:"extendedLocations"`
+	Type              string       `json:"type"`
+}
+
+// ZoneDetail holds capabilities that only apply in some of the zones of a location
+type ZoneDetail struct {
+	Name         []string     `json:"name"`
+	Capabilities []Capability `json:"capabilities"`
+}
+
+// Capability is a name/value pair; values are always sent as strings
+type Capability struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Restriction explains why a SKU cannot be used in some locations or zones
+type Restriction struct {
+	Type            string          `json:"type"` // Location or Zone
+	Values          []string        `json:"values"`
+	RestrictionInfo RestrictionInfo `json:"restrictionInfo"`
+	ReasonCode      string          `json:"reasonCode"` // QuotaId or NotAvailableForSubscription
+}
+
+// RestrictionInfo lists the locations and zones a restriction applies to
+type RestrictionInfo struct {
+	Locations []string `json:"locations"`
+	Zones     []string `json:"zones"`
+}
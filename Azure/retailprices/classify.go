@@ -0,0 +1,81 @@
+package retailprices
+
+import "strings"
+
+// Operating systems of a VM price
+const (
+	OSLinux   = "Linux"
+	OSWindows = "Windows"
+)
+
+// License models of a VM price
+const (
+	LicenseIncluded    = "LicenseIncluded" // the Windows license is part of the price
+	LicenseNotIncluded = "NotIncluded"     // Linux, reservations, and Windows at dev/test rates
+)
+
+// Priorities of a VM price
+const (
+	PriorityRegular     = "Regular"
+	PrioritySpot        = "Spot"
+	PriorityLowPriority = "LowPriority"
+)
+
+// VMPriceClass describes what a virtual machine price item is the price of. The feed
+// only tells this through productName, skuName and meterName. Items of other services
+// have the zero class.
+type VMPriceClass struct {
+	// OperatingSystem is Linux or Windows, empty for reservations which cover compute
+	// for any operating system
+	OperatingSystem string
+	LicenseModel    string
+	Priority        string
+	// DevTestEligible is set on dev/test prices and on the regular consumption prices a
+	// Dev/Test subscription can be billed at dev/test rates instead of
+	DevTestEligible bool
+}
+
+// ClassifyVMPrice derives the class of a virtual machine price item, e.g.
+//
+//	productName "Virtual Machines Dsv5 Series Windows", meterName "D8s v5 Spot"
+//
+// is a Windows spot price with the license included. Items of other services than
+// Virtual Machines are not classified.
+func ClassifyVMPrice(item PriceItem) VMPriceClass {
+	if item.ServiceName != ServiceVirtualMachines {
+		return VMPriceClass{}
+	}
+
+	class := VMPriceClass{
+		OperatingSystem: OSLinux,
+		LicenseModel:    LicenseNotIncluded,
+		Priority:        PriorityRegular,
+	}
+
+	names := strings.ToLower(item.SkuName + " " + item.MeterName)
+	switch {
+	case strings.Contains(names, "low priority"):
+		class.Priority = PriorityLowPriority
+	case strings.Contains(names, "spot"):
+		class.Priority = PrioritySpot
+	}
+
+	switch item.Type {
+	case PriceTypeReservation:
+		class.OperatingSystem = ""
+		return class
+	case PriceTypeDevTestConsumption:
+		class.DevTestEligible = true
+	case PriceTypeConsumption:
+		class.DevTestEligible = class.Priority == PriorityRegular
+	}
+
+	if strings.Contains(strings.ToLower(item.ProductName), "windows") {
+		class.OperatingSystem = OSWindows
+		// Dev/test prices are Windows VMs billed at the Linux rate
+		if item.Type != PriceTypeDevTestConsumption {
+			class.LicenseModel = LicenseIncluded
+		}
+	}
+	return class
+}
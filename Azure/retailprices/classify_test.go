@@ -0,0 +1,29 @@
+package retailprices
+
+import "testing"
+
+func TestClassifyVMPrice(t *testing.T) {
+	vm := func(priceType, productName, meterName string) PriceItem {
+		return PriceItem{ServiceName: ServiceVirtualMachines, Type: priceType, ProductName: productName, SkuName: meterName, MeterName: meterName}
+	}
+	tests := []struct {
+		name string
+		item PriceItem
+		want VMPriceClass
+	}{
+		{"linux", vm(PriceTypeConsumption, "Virtual Machines Dsv5 Series", "D8s v5"), VMPriceClass{OSLinux, LicenseNotIncluded, PriorityRegular, true}},
+		{"windows spot", vm(PriceTypeConsumption, "Virtual Machines Dsv5 Series Windows", "D8s v5 Spot"), VMPriceClass{OSWindows, LicenseIncluded, PrioritySpot, false}},
+		{"low priority", vm(PriceTypeConsumption, "Virtual Machines Dv2 Series", "D2 v2 Low Priority"), VMPriceClass{OSLinux, LicenseNotIncluded, PriorityLowPriority, false}},
+		{"windows dev/test", vm(PriceTypeDevTestConsumption, "Virtual Machines Dsv5 Series Windows", "D8s v5"), VMPriceClass{OSWindows, LicenseNotIncluded, PriorityRegular, true}},
+		{"reservation", vm(PriceTypeReservation, "Virtual Machines Dsv5 Series", "D8s v5"), VMPriceClass{"", LicenseNotIncluded, PriorityRegular, false}},
+		{"other service", PriceItem{ServiceName: "Storage", Type: PriceTypeConsumption, ProductName: "Premium SSD Managed Disks", MeterName: "P10 LRS Disk"}, VMPriceClass{}},
+		{"windows other service", PriceItem{ServiceName: "Azure Dedicated Host", Type: PriceTypeConsumption, ProductName: "Windows Server", MeterName: "Spot"}, VMPriceClass{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyVMPrice(tt.item); got != tt.want {
+				t.Errorf("ClassifyVMPrice() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
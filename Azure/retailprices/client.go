@@ -0,0 +1,95 @@
+package retailprices
+
+import (
+	"cco_backend/utils"
+	"context"
+	"fmt"
+)
+
+// DefaultEndpoint is the public Azure Retail Prices API endpoint
+const DefaultEndpoint = "https://prices.azure.com/api/retail/prices"
+
+// Client fetches and decodes pages of the Azure Retail Prices API
+type Client struct {
+	// Fetch returns the raw body of a page, defaults to utils.FetchBody
+	Fetch func(ctx context.Context, url string) ([]byte, error)
+}
+
+// NewClient returns a Client that fetches pages through the shared utils HTTP helpers
+func NewClient() *Client {
+	return &Client{Fetch: utils.FetchBody}
+}
+
+// FetchPage fetches and decodes a single page. pageNum is only used for error reporting.
+func (c *Client) FetchPage(ctx context.Context, pageURL string, pageNum int) (*PricesPage, error) {
+	body, err := c.Fetch(ctx, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching price page %d: %w", pageNum, err)
+	}
+	return DecodePage(body, pageNum, pageURL)
+}
+
+// Pager iterates over every page of a Retail Prices query by following NextPageLink
+//
+//	pager := client.NewPager(ctx, url)
+//	for pager.Next() {
+//		for _, item := range pager.Page().Items { ... }
+//	}
+//	if err := pager.Err(); err != nil { ... }
+type Pager struct {
+	ctx     context.Context
+	client  *Client
+	nextURL string
+	pageNum int
+	current *PricesPage
+	err     error
+}
+
+// NewPager returns a Pager starting at startURL. Every page is fetched with ctx.
+func (c *Client) NewPager(ctx context.Context, startURL string) *Pager {
+	return &Pager{ctx: ctx, client: c, nextURL: startURL}
+}
+
+// ResumePager returns a Pager that continues a crawl at nextURL after pagesDone pages
+// were already processed, so page numbers keep counting from where the crawl stopped
+func (c *Client) ResumePager(ctx context.Context, nextURL string, pagesDone int) *Pager {
+	return &Pager{ctx: ctx, client: c, nextURL: nextURL, pageNum: pagesDone}
+}
+
+// Next fetches the next page and reports whether one is available
+func (p *Pager) Next() bool {
+	if p.err != nil || p.nextURL == "" {
+		return false
+	}
+
+	page, err := p.client.FetchPage(p.ctx, p.nextURL, p.pageNum+1)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	p.pageNum++
+	p.current = page
+	p.nextURL = page.NextPageLink
+	return true
+}
+
+// Page returns the page fetched by the last call to Next
+func (p *Pager) Page() *PricesPage {
+	return p.current
+}
+
+// PageNumber returns the 1-based number of the current page
+func (p *Pager) PageNumber() int {
+	return p.pageNum
+}
+
+// NextPageLink returns the URL of the page that the next call to Next will fetch
+func (p *Pager) NextPageLink() string {
+	return p.nextURL
+}
+
+// Err returns the error that stopped the iteration, if any
+func (p *Pager) Err() error {
+	return p.err
+}
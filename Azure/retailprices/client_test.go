@@ -0,0 +1,101 @@
+package retailprices
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newPagedServer serves pages pages of one item each, linking every page to the next
+func newPagedServer(t *testing.T, pages int) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if n < 1 || n > pages {
+			http.NotFound(w, r)
+			return
+		}
+		next := ""
+		if n < pages {
+			next = fmt.Sprintf("%s/?page=%d", server.URL, n+1)
+		}
+		item := fmt.Sprintf(`{"skuId":"sku-%d","meterId":"m","type":"Consumption","effectiveStartDate":"2023-01-01T00:00:00Z"}`, n)
+		fmt.Fprintf(w, `{"BillingCurrency":"USD","Items":[%s],"NextPageLink":%q,"Count":1}`, item, next)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testClient(server *httptest.Server) *Client {
+	return &Client{Fetch: func(ctx context.Context, url string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}}
+}
+
+func TestPagerFollowsNextPageLink(t *testing.T) {
+	server := newPagedServer(t, 3)
+	pager := testClient(server).NewPager(context.Background(), server.URL+"/?page=1")
+
+	var skus []string
+	for pager.Next() {
+		if pager.PageNumber() != len(skus)+1 {
+			t.Errorf("page number = %d, want %d", pager.PageNumber(), len(skus)+1)
+		}
+		skus = append(skus, pager.Page().Items[0].SkuID)
+	}
+	if err := pager.Err(); err != nil {
+		t.Fatalf("pager: %v", err)
+	}
+	if fmt.Sprint(skus) != "[sku-1 sku-2 sku-3]" {
+		t.Errorf("items = %v", skus)
+	}
+	if pager.NextPageLink() != "" {
+		t.Errorf("NextPageLink after the last page = %q", pager.NextPageLink())
+	}
+}
+
+func TestResumePager(t *testing.T) {
+	server := newPagedServer(t, 3)
+	pager := testClient(server).ResumePager(context.Background(), server.URL+"/?page=3", 2)
+
+	if !pager.Next() {
+		t.Fatalf("resumed pager returned no page: %v", pager.Err())
+	}
+	if pager.PageNumber() != 3 || pager.Page().Items[0].SkuID != "sku-3" {
+		t.Errorf("page %d with %s, want page 3 with sku-3", pager.PageNumber(), pager.Page().Items[0].SkuID)
+	}
+	if pager.Next() {
+		t.Errorf("pager continued past the last page")
+	}
+}
+
+func TestPagerStopsOnError(t *testing.T) {
+	server := newPagedServer(t, 1)
+	pager := testClient(server).NewPager(context.Background(), server.URL+"/?page=2")
+
+	if pager.Next() {
+		t.Fatal("expected no page")
+	}
+	if pager.Err() == nil {
+		t.Fatal("expected an error")
+	}
+	if pager.NextPageLink() == "" {
+		t.Error("failed page should still be the next one to fetch")
+	}
+}
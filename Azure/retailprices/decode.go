@@ -0,0 +1,126 @@
+package retailprices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DecodeError reports which field of which page could not be decoded
+type DecodeError struct {
+	Page  int    // 1-based page number within the crawl
+	URL   string // URL the page was fetched from
+	Item  int    // index into Items, or -1 when the envelope itself is invalid
+	Field string // JSON field name, empty when it cannot be determined
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "error decoding page %d", e.Page)
+	if e.Item >= 0 {
+		fmt.Fprintf(&b, " item %d", e.Item)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, " field %q", e.Field)
+	}
+	fmt.Fprintf(&b, " (%s): %v", e.URL, e.Err)
+	return b.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// rawPage mirrors PricesPage but keeps items undecoded so each one can be checked on its own
+type rawPage struct {
+	BillingCurrency    string            `json:"BillingCurrency"`
+	CustomerEntityID   string            `json:"CustomerEntityId"`
+	CustomerEntityType string            `json:"CustomerEntityType"`
+	Items              []json.RawMessage `json:"Items"`
+	NextPageLink       string            `json:"NextPageLink"`
+	Count              int               `json:"Count"`
+}
+
+// DecodePage decodes a raw Retail Prices response body. pageNum and pageURL are only
+// used to describe the failing location in a DecodeError.
+func DecodePage(body []byte, pageNum int, pageURL string) (*PricesPage, error) {
+	var raw rawPage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, &DecodeError{Page: pageNum, URL: pageURL, Item: -1, Field: typeErrorField(err), Err: err}
+	}
+	if raw.Items == nil {
+		return nil, &DecodeError{Page: pageNum, URL: pageURL, Item: -1, Field: "Items", Err: errors.New("missing field")}
+	}
+
+	page := &PricesPage{
+		BillingCurrency:    raw.BillingCurrency,
+		CustomerEntityID:   raw.CustomerEntityID,
+		CustomerEntityType: raw.CustomerEntityType,
+		NextPageLink:       raw.NextPageLink,
+		Count:              raw.Count,
+		Items:              make([]PriceItem, len(raw.Items)),
+	}
+
+	for i, itemBody := range raw.Items {
+		if field, err := decodeItem(itemBody, &page.Items[i]); err != nil {
+			return nil, &DecodeError{Page: pageNum, URL: pageURL, Item: i, Field: field, Err: err}
+		}
+	}
+
+	return page, nil
+}
+
+// decodeItem decodes a single price item and returns the name of the offending field on failure
+func decodeItem(body json.RawMessage, item *PriceItem) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", err
+	}
+
+	for _, name := range requiredItemFields {
+		value, ok := fields[name]
+		if !ok || string(value) == "null" || string(value) == `""` {
+			return name, errors.New("missing required field")
+		}
+	}
+
+	if err := json.Unmarshal(body, item); err != nil {
+		if field := typeErrorField(err); field != "" {
+			return field, err
+		}
+		// Errors raised by a field's own UnmarshalJSON (time.Time for example) carry no
+		// field name, so retry the fields one by one to find out which one failed
+		return locateField(fields, item), err
+	}
+
+	return "", nil
+}
+
+// typeErrorField extracts the field name from a json.UnmarshalTypeError
+func typeErrorField(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Field
+	}
+	return ""
+}
+
+// locateField decodes every known field on its own and returns the first one that fails
+func locateField(fields map[string]json.RawMessage, target interface{}) string {
+	t := reflect.TypeOf(target).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		probe := reflect.New(t.Field(i).Type)
+		if err := json.Unmarshal(value, probe.Interface()); err != nil {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package retailprices
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const validItem = `{"currencyCode":"USD","retailPrice":0.096,"unitPrice":0.096,"armRegionName":"eastus",
+	"effectiveStartDate":"2023-01-01T00:00:00Z","meterId":"m-1","skuId":"DZH318Z0BQPS/00TG",
+	"productName":"Virtual Machines Dv5 Series","skuName":"D2 v5","unitOfMeasure":"1 Hour",
+	"type":"Consumption","armSkuName":"Standard_D2_v5",
+	"savingsPlan":[{"unitPrice":0.07,"retailPrice":0.07,"term":"1 Year"}]}`
+
+func TestDecodePage(t *testing.T) {
+	body := `{"BillingCurrency":"USD","Items":[` + validItem + `],"NextPageLink":"https://next","Count":1}`
+
+	page, err := DecodePage([]byte(body), 1, "https://page")
+	if err != nil {
+		t.Fatalf("DecodePage: %v", err)
+	}
+	if len(page.Items) != 1 || page.NextPageLink != "https://next" || page.BillingCurrency != "USD" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	item := page.Items[0]
+	if item.ArmSkuName != "Standard_D2_v5" || item.RetailPrice != 0.096 || item.EffectiveStartDate.Year() != 2023 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if len(item.SavingsPlan) != 1 || item.SavingsPlan[0].Term != "1 Year" {
+		t.Errorf("unexpected savings plan: %+v", item.SavingsPlan)
+	}
+}
+
+func TestDecodePageErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		item  int
+		field string
+	}{
+		{"invalid envelope", `{"Items":`, -1, ""},
+		{"envelope type", `{"Items":[],"Count":"one"}`, -1, "Count"},
+		{"missing items", `{"Count":0}`, -1, "Items"},
+		{"missing required field", `{"Items":[` + validItem + `,{"meterId":"m","type":"Consumption","effectiveStartDate":"2023-01-01T00:00:00Z"}]}`, 1, "skuId"},
+		{"empty required field", `{"Items":[{"skuId":"","meterId":"m","type":"Consumption","effectiveStartDate":"2023-01-01T00:00:00Z"}]}`, 0, "skuId"},
+		{"wrong type", `{"Items":[` + strings.Replace(validItem, `"retailPrice":0.096`, `"retailPrice":"cheap"`, 1) + `]}`, 0, "retailPrice"},
+		{"invalid time", `{"Items":[` + strings.Replace(validItem, `"2023-01-01T00:00:00Z"`, `"yesterday"`, 1) + `]}`, 0, "effectiveStartDate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePage([]byte(tt.body), 3, "https://page/3")
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected a DecodeError, got %v", err)
+			}
+			if decodeErr.Page != 3 || decodeErr.URL != "https://page/3" {
+				t.Errorf("page = %d, url = %q", decodeErr.Page, decodeErr.URL)
+			}
+			if decodeErr.Item != tt.item {
+				t.Errorf("item = %d, want %d", decodeErr.Item, tt.item)
+			}
+			if decodeErr.Field != tt.field {
+				t.Errorf("field = %q, want %q", decodeErr.Field, tt.field)
+			}
+			if !strings.Contains(err.Error(), "page 3") {
+				t.Errorf("error does not name the page: %v", err)
+			}
+		})
+	}
+}
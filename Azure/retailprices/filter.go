@@ -0,0 +1,138 @@
+package retailprices
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Filter is an OData $filter expression understood by the Retail Prices API.
+// The zero Filter matches everything and is dropped when combined with others.
+type Filter struct {
+	expr string
+	or   bool // top-level operator is "or", so it needs parentheses inside an "and"
+}
+
+// Raw wraps an expression that is already valid OData, such as a user supplied filter
+func Raw(expr string) Filter {
+	expr = strings.TrimSpace(expr)
+	return Filter{expr: expr, or: strings.Contains(strings.ToLower(expr), " or ")}
+}
+
+// Eq matches items whose field equals value
+func Eq(field, value string) Filter {
+	return Filter{expr: fmt.Sprintf("%s eq %s", field, quote(value))}
+}
+
+// Ne matches items whose field differs from value
+func Ne(field, value string) Filter {
+	return Filter{expr: fmt.Sprintf("%s ne %s", field, quote(value))}
+}
+
+// Contains matches items whose field contains value
+func Contains(field, value string) Filter {
+	return Filter{expr: fmt.Sprintf("contains(%s, %s)", field, quote(value))}
+}
+
+// In matches items whose field equals any of values; with no values it matches everything
+func In(field string, values ...string) Filter {
+	filters := make([]Filter, len(values))
+	for i, value := range values {
+		filters[i] = Eq(field, value)
+	}
+	return Or(filters...)
+}
+
+// EffectiveBetween matches items whose effectiveStartDate is at or after from and before
+// to. A zero bound is left open.
+func EffectiveBetween(from, to time.Time) Filter {
+	var bounds []Filter
+	if !from.IsZero() {
+		bounds = append(bounds, Filter{expr: "effectiveStartDate ge " + from.UTC().Format(time.RFC3339)})
+	}
+	if !to.IsZero() {
+		bounds = append(bounds, Filter{expr: "effectiveStartDate lt " + to.UTC().Format(time.RFC3339)})
+	}
+	return And(bounds...)
+}
+
+// And matches items matching every filter
+func And(filters ...Filter) Filter {
+	var parts []string
+	for _, f := range filters {
+		switch {
+		case f.IsZero():
+			continue
+		case f.or:
+			parts = append(parts, "("+f.expr+")")
+		default:
+			parts = append(parts, f.expr)
+		}
+	}
+	return Filter{expr: strings.Join(parts, " and ")}
+}
+
+// Or matches items matching any of the filters
+func Or(filters ...Filter) Filter {
+	var parts []string
+	for _, f := range filters {
+		if !f.IsZero() {
+			parts = append(parts, f.expr)
+		}
+	}
+	return Filter{expr: strings.Join(parts, " or "), or: len(parts) > 1}
+}
+
+// IsZero reports whether the filter matches everything
+func (f Filter) IsZero() bool {
+	return f.expr == ""
+}
+
+// String returns the filter as an unencoded OData expression
+func (f Filter) String() string {
+	return f.expr
+}
+
+// quote renders value as an OData string literal
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Query describes a single Retail Prices API request
+type Query struct {
+	Endpoint     string // defaults to DefaultEndpoint
+	APIVersion   string // omitted when empty
+	CurrencyCode string // USD when empty
+	Filter       Filter
+}
+
+// URL returns the encoded URL of the first page of the query
+func (q Query) URL() string {
+	endpoint := q.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	var params []string
+	if q.APIVersion != "" {
+		params = append(params, "api-version="+queryEscape(q.APIVersion))
+	}
+	if q.CurrencyCode != "" {
+		params = append(params, "currencyCode="+queryEscape(quote(q.CurrencyCode)))
+	}
+	if !q.Filter.IsZero() {
+		params = append(params, "$filter="+queryEscape(q.Filter.String()))
+	}
+
+	if len(params) == 0 {
+		return endpoint
+	}
+	return endpoint + "?" + strings.Join(params, "&")
+}
+
+// queryEscape escapes a query parameter value, including & and +, and encodes spaces as
+// %20 rather than +
+func queryEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
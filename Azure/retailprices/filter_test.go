@@ -0,0 +1,74 @@
+package retailprices
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterBuilders(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"eq", Eq("serviceName", "Virtual Machines"), "serviceName eq 'Virtual Machines'"},
+		{"quote", Eq("productName", "O'Brien"), "productName eq 'O''Brien'"},
+		{"in", In("priceType", "Consumption", "Reservation"), "priceType eq 'Consumption' or priceType eq 'Reservation'"},
+		{"empty in", In("priceType"), ""},
+		{"or inside and", And(Eq("a", "1"), In("b", "2", "3")), "a eq '1' and (b eq '2' or b eq '3')"},
+		{"zero dropped", And(Filter{}, Eq("a", "1"), Or()), "a eq '1'"},
+		{"effective", EffectiveBetween(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}), "effectiveStartDate ge 2024-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryURLRoundTrip(t *testing.T) {
+	filter := And(
+		In("serviceName", "Virtual Machines", "A&B"),
+		Eq("productName", "Premium+SSD"),
+		Contains("meterName", "50% off; #1"),
+	)
+	query := Query{Endpoint: "https://prices.example/api", APIVersion: "2023-01-01-preview", CurrencyCode: "EUR", Filter: filter}
+
+	raw := query.URL()
+	if !strings.HasPrefix(raw, "https://prices.example/api?") {
+		t.Fatalf("unexpected URL %s", raw)
+	}
+	if strings.Contains(raw, " ") {
+		t.Errorf("URL contains an unescaped space: %s", raw)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	values, err := url.ParseQuery(parsed.RawQuery)
+	if err != nil {
+		t.Fatalf("parse query: %v", err)
+	}
+	if got := values.Get("$filter"); got != filter.String() {
+		t.Errorf("$filter = %q, want %q", got, filter.String())
+	}
+	if got := values.Get("currencyCode"); got != "'EUR'" {
+		t.Errorf("currencyCode = %q", got)
+	}
+	if got := values.Get("api-version"); got != "2023-01-01-preview" {
+		t.Errorf("api-version = %q", got)
+	}
+	if len(values) != 3 {
+		t.Errorf("unexpected parameters %v", values)
+	}
+}
+
+func TestQueryURLDefaults(t *testing.T) {
+	if got := (Query{}).URL(); got != DefaultEndpoint {
+		t.Errorf("got %s, want %s", got, DefaultEndpoint)
+	}
+}
@@ -0,0 +1,62 @@
+package retailprices
+
+import "time"
+
+// Values of the type field of a PriceItem, also used as priceType in filters
+const (
+	PriceTypeConsumption        = "Consumption"
+	PriceTypeReservation        = "Reservation"
+	PriceTypeDevTestConsumption = "DevTestConsumption"
+)
+
+// ServiceVirtualMachines is the serviceName of virtual machine price items
+const ServiceVirtualMachines = "Virtual Machines"
+
+// PricesPage is the response envelope returned by the Azure Retail Prices API
+type PricesPage struct {
+	BillingCurrency    string      `json:"BillingCurrency"`
+	CustomerEntityID   string      `json:"CustomerEntityId"`
+	CustomerEntityType string      `json:"CustomerEntityType"`
+	Items              []PriceItem `json:"Items"`
+	NextPageLink       string      `json:"NextPageLink"`
+	Count              int         `json:"Count"`
+}
+
+// PriceItem is a single entry of the Items array of a PricesPage
+type PriceItem struct {
+	CurrencyCode         string            `json:"currencyCode"`
+	TierMinimumUnits     float64           `json:"tierMinimumUnits"`
+	RetailPrice          float64           `json:"retailPrice"`
+	UnitPrice            float64           `json:"unitPrice"`
+	ArmRegionName        string            `json:"armRegionName"`
+	Location             string            `json:"location"`
+	EffectiveStartDate   time.Time         `json:"effectiveStartDate"`
+	EffectiveEndDate     *time.Time        `json:"effectiveEndDate"`
+	MeterID              string            `json:"meterId"`
+	MeterName            string            `json:"meterName"`
+	ProductID            string            `json:"productId"`
+	SkuID                string            `json:"skuId"`
+	AvailabilityID       *string           `json:"availabilityId"`
+	ProductName          string            `json:"productName"`
+	SkuName              string            `json:"skuName"`
+	ServiceName          string            `json:"serviceName"`
+	ServiceID            string            `json:"serviceId"`
+	ServiceFamily        string            `json:"serviceFamily"`
+	UnitOfMeasure        string            `json:"unitOfMeasure"`
+	Type                 string            `json:"type"`
+	IsPrimaryMeterRegion bool              `json:"isPrimaryMeterRegion"`
+	ArmSkuName           string            `json:"armSkuName"`
+	ReservationTerm      string            `json:"reservationTerm"`
+	SavingsPlan          []SavingsPlanRate `json:"savingsPlan"`
+}
+
+// SavingsPlanRate is one entry of the savingsPlan array attached to a consumption price item
+type SavingsPlanRate struct {
+	UnitPrice   float64 `json:"unitPrice"`
+	RetailPrice float64 `json:"retailPrice"`
+	Term        string  `json:"term"`
+}
+
+// requiredItemFields lists the item fields every importer relies on; an item missing
+// one of them is reported as a decode error instead of being skipped
+var requiredItemFields = []string{"skuId", "meterId", "type", "effectiveStartDate"}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"cco_backend/catalogdiff"
+	"cco_backend/config"
+	"context"
+	"fmt"
+	"time"
+)
+
+// skuColumns selects the natural key of a SKU row as the fields of catalogdiff.SkuEntry
+const skuColumns = `COALESCE(skus.sku_id_api, '') AS sku_code, regions.region_code AS region,
+	skus.type AS type, COALESCE(skus.armskuname, '') AS arm_sku_name`
+
+// TakeCatalogSnapshot reads the regions, SKUs, prices in effect and their terms from
+// the database. Regions and SKUs a complete import no longer listed are disabled and
+// left out, together with their prices. Taking one before and after an import and
+// passing both to catalogdiff.Diff shows what the import changed.
+func TakeCatalogSnapshot(ctx context.Context) (*catalogdiff.Snapshot, error) {
+	db := config.DB.WithContext(ctx)
+	snapshot := &catalogdiff.Snapshot{TakenAt: time.Now().UTC()}
+
+	err := db.Table("regions").
+		Select("region_code AS code, cloud").
+		Where("disable_flag IS NOT TRUE").
+		Order("cloud, region_code").
+		Scan(&snapshot.Regions).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading regions for snapshot: %w", err)
+	}
+
+	err = db.Table("skus").
+		Select(skuColumns).
+		Joins("JOIN regions ON regions.region_id = skus.region_id").
+		Where("skus.disable_flag IS NOT TRUE").
+		Scan(&snapshot.Skus).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading SKUs for snapshot: %w", err)
+	}
+
+	inEffect := `prices.effective_date <= @at AND (prices.effective_end_date IS NULL OR prices.effective_end_date > @at)
+		AND skus.disable_flag IS NOT TRUE`
+	at := map[string]interface{}{"at": snapshot.TakenAt}
+
+	err = db.Table("prices").
+		Select(skuColumns+`, prices.meter_id, prices.tier_minimum_units, prices.reservation_term, prices.currency_code,
+			prices.retail_price, prices.unit, prices.effective_date`).
+		Joins("JOIN skus ON skus.id = prices.sku_id").
+		Joins("JOIN regions ON regions.region_id = skus.region_id").
+		Where(inEffect, at).
+		Scan(&snapshot.Prices).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading prices for snapshot: %w", err)
+	}
+
+	err = db.Table("terms").
+		Select(skuColumns+`, prices.meter_id, prices.currency_code,
+			COALESCE(terms.purchase_option, '') AS purchase_option,
+			COALESCE(terms.lease_contract_length, '') AS lease_contract_length`).
+		Joins("JOIN prices ON prices.price_id = terms.price_id").
+		Joins("JOIN skus ON skus.id = prices.sku_id").
+		Joins("JOIN regions ON regions.region_id = skus.region_id").
+		Where(inEffect, at).
+		Scan(&snapshot.Terms).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading terms for snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
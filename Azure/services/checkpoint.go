@@ -0,0 +1,128 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"cco_backend/retailprices"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultCheckpointMaxAge is how long a checkpoint stays usable. The Retail Prices API
+// paginates with $skip, so resuming from a very old link may skip or repeat items.
+const defaultCheckpointMaxAge = 24 * time.Hour
+
+// Checkpoint names of the importers, usable with ResetCheckpoint
+const (
+	RegionImport = "regions"
+	SkuImport    = "skus"
+	PriceImport  = "prices"
+	TermImport   = "terms"
+)
+
+// pageHandler imports a single page of price items using the page's transaction
+type pageHandler func(tx *gorm.DB, page *retailprices.PricesPage) error
+
+// resumePoint returns the URL and page count an import should start from, or an empty
+// URL when the import already finished but its run did not get to clear the checkpoint.
+// The saved checkpoint is ignored when IMPORT_FRESH_START is set, when it belongs to a
+// different base URL, or when it is older than IMPORT_CHECKPOINT_MAX_AGE.
+func resumePoint(ctx context.Context, importName, baseURL string) (string, int, error) {
+	if fresh, _ := strconv.ParseBool(os.Getenv("IMPORT_FRESH_START")); fresh {
+		log.Printf("%s: IMPORT_FRESH_START set, discarding checkpoint", importName)
+		return baseURL, 0, ResetCheckpoint(ctx, importName)
+	}
+
+	var checkpoint models.ImportCheckpoint
+	err := config.DB.WithContext(ctx).Where("import_name = ?", importName).First(&checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return baseURL, 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("error loading checkpoint for %s: %w", importName, err)
+	}
+
+	maxAge := defaultCheckpointMaxAge
+	if value, err := time.ParseDuration(os.Getenv("IMPORT_CHECKPOINT_MAX_AGE")); err == nil && value > 0 {
+		maxAge = value
+	}
+
+	switch {
+	case checkpoint.BaseURL != baseURL:
+		log.Printf("%s: checkpoint was taken for a different query, starting fresh", importName)
+		return baseURL, 0, ResetCheckpoint(ctx, importName)
+	case time.Since(checkpoint.ModifiedDate) > maxAge:
+		log.Printf("%s: checkpoint from %s is stale, starting fresh", importName, checkpoint.ModifiedDate.Format(time.RFC3339))
+		return baseURL, 0, ResetCheckpoint(ctx, importName)
+	}
+
+	if checkpoint.NextPageLink == "" {
+		log.Printf("%s: already completed in an earlier run", importName)
+		return "", checkpoint.PageCount, nil
+	}
+
+	log.Printf("%s: resuming after page %d", importName, checkpoint.PageCount)
+	return checkpoint.NextPageLink, checkpoint.PageCount, nil
+}
+
+// saveCheckpoint records the next page to fetch as part of the page's transaction
+func saveCheckpoint(tx *gorm.DB, importName, baseURL, nextPageLink string, pageCount int) error {
+	checkpoint := models.ImportCheckpoint{
+		ImportName:   importName,
+		BaseURL:      baseURL,
+		NextPageLink: nextPageLink,
+		PageCount:    pageCount,
+		ModifiedDate: time.Now(),
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "import_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"base_url", "next_page_link", "page_count", "modified_date"}),
+	}).Create(&checkpoint).Error
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint for %s: %w", importName, err)
+	}
+	return nil
+}
+
+// ResetCheckpoint discards the saved checkpoint of an import so its next run starts from
+// the first page
+func ResetCheckpoint(ctx context.Context, importName string) error {
+	if err := config.DB.WithContext(ctx).Where("import_name = ?", importName).Delete(&models.ImportCheckpoint{}).Error; err != nil {
+		return fmt.Errorf("error removing checkpoint for %s: %w", importName, err)
+	}
+	return nil
+}
+
+// crawlStartedAt returns when the crawl of the shards began: now for a fresh crawl, or
+// the first checkpoint of a crawl that resumes. A checkpoint discarded later for being
+// stale only makes the result earlier than the actual start.
+func crawlStartedAt(ctx context.Context, phases [][]shard) (time.Time, error) {
+	var names []string
+	for _, shards := range phases {
+		for _, s := range shards {
+			names = append(names, s.name)
+		}
+	}
+
+	start := time.Now()
+	var first *time.Time
+	err := config.DB.WithContext(ctx).Model(&models.ImportCheckpoint{}).
+		Where("import_name IN ?", names).
+		Select("MIN(created_date)").
+		Scan(&first).Error
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error loading checkpoints: %w", err)
+	}
+	if first != nil && first.Before(start) {
+		start = *first
+	}
+	return start, nil
+}
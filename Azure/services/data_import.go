@@ -1,67 +1,121 @@
 package services
 
 import (
-	"fmt"
-	"log"
 	"cco_backend/config"
 	"cco_backend/models"
+	"cco_backend/retailprices"
 	"cco_backend/utils"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func ImportData() error { // fetch and import price data from API
-	baseURL := "https://prices.azure.com/api/retail/prices?api-version=2023-01-01-preview&$filter=serviceName%20eq%20%27Virtual%20Machines%27"
-	nextPageLink := baseURL
+func ImportData(ctx context.Context) error { // fetch and import region data from the price API
+	if err := RunPipeline(ctx, RegionImport); err != nil {
+		return err
+	}
 
-	// Insert Provider and Service once, as they remain constant throughout the data
-	provider := models.Provider{ProviderName: "Azure"}
-	result := config.DB.Where("provider_name = ?", provider.ProviderName).FirstOrCreate(&provider)
+	fmt.Println("Data import completed successfully!")
+	return nil
+}
+
+// regionSink inserts a Region row for every region of the active cloud seen in the price
+// feed. The public feed also lists the regions of the sovereign clouds, so regions that
+// belong to another cloud are left out.
+type regionSink struct {
+	cloud    utils.Cloud
+	provider models.Provider
+	skipped  map[string]bool // regions of other clouds, logged once each
+}
+
+func (s *regionSink) Name() string        { return RegionImport }
+func (s *regionSink) DependsOn() []string { return nil }
+
+func (s *regionSink) Prepare(ctx context.Context) error {
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return err
+	}
+
+	s.cloud = cloud
+	s.skipped = map[string]bool{}
+
+	// Insert Provider once per cloud, as it remains constant throughout the data
+	s.provider = models.Provider{ProviderName: "Azure", Cloud: cloud.Name}
+	result := config.DB.WithContext(ctx).Where("provider_name = ? AND cloud = ?", s.provider.ProviderName, s.provider.Cloud).FirstOrCreate(&s.provider)
 	if result.Error != nil {
 		return fmt.Errorf("Error inserting provider: %v", result.Error)
-	} else {
-		log.Printf("Provider inserted or already exists: %v", provider.ProviderName)
 	}
+	log.Printf("Provider inserted or already exists: %v (%s)", s.provider.ProviderName, s.provider.Cloud)
+	return nil
+}
 
-	for nextPageLink != "" { // loops through the API's paginated responses
-		// Fetch data from the current page of the price API
-		priceData, err := utils.FetchData(nextPageLink)
-		if err != nil {
-			return fmt.Errorf("error fetching price data: %w", err)
+func (s *regionSink) Consume(tx *gorm.DB, page *retailprices.PricesPage) error {
+	var regions []models.Region
+	seen := map[string]bool{}
+	now := time.Now()
+	for _, item := range page.Items {
+		// Regions are keyed by their ARM name so the SKU sink can look them up;
+		// items without one (global meters) fall back to the display location
+		regionCode := item.ArmRegionName
+		if regionCode == "" {
+			regionCode = item.Location
 		}
-
-		// Extract items from the JSON response - contains array of pricing data
-		items, ok := priceData["Items"].([]interface{})
-		if !ok {
-			return fmt.Errorf("invalid data structure for items")
+		if seen[regionCode] {
+			continue
 		}
-
-		// Iterate over each item in the current page
-		for _, item := range items {
-			data := item.(map[string]interface{})
-
-			// For region table
-			regionCode, _ := data["location"].(string)
-
-			// Insert Region if not exists
-			region := models.Region{
-				ProviderID: provider.ProviderID,
-				RegionCode: regionCode,
-			}
-			result = config.DB.Where("region_code = ?", region.RegionCode).FirstOrCreate(&region)
-			if result.Error != nil {
-				log.Printf("Error inserting region: %v", result.Error)
-			} else {
-				log.Printf("Region inserted or already exists: %v", region.RegionCode)
+		seen[regionCode] = true
+		if !s.cloud.HasRegion(regionCode) {
+			if !s.skipped[regionCode] {
+				s.skipped[regionCode] = true
+				log.Printf("Region %s does not belong to %s, skipping", regionCode, s.cloud.Name)
 			}
+			continue
 		}
 
-		// Update the nextPageLink for the next iteration (handles pagination)
-		if nextLink, ok := priceData["NextPageLink"].(string); ok && nextLink != "" {
-			nextPageLink = nextLink
-		} else {
-			nextPageLink = "" // Exit the loop if there's no next page
-		}
+		regions = append(regions, models.Region{
+			ProviderID: s.provider.ProviderID,
+			RegionCode: regionCode,
+			Cloud:      s.provider.Cloud,
+			LastSeenAt: &now,
+		})
+	}
+	if len(regions) == 0 {
+		return nil
 	}
 
-	fmt.Println("Data import completed successfully!")
+	// Insert the regions that do not exist yet and mark all of them as seen
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "region_code"}, {Name: "cloud"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen_at", "disable_flag"}),
+	}).Create(&regions).Error
+	if err != nil {
+		return fmt.Errorf("error inserting regions: %w", err)
+	}
+	return nil
+}
+
+// Finish disables the regions of the cloud that the completed crawl no longer listed,
+// so they show up as removed in catalog reports. A crawl narrowed to some regions, to
+// services other than VMs, by date or by a raw filter does not see every region, so
+// nothing is disabled then (see coversVMCatalog).
+func (s *regionSink) Finish(ctx context.Context, crawlStart time.Time) error {
+	scope := config.LoadPriceImportConfig()
+	if len(scope.Regions) > 0 || !coversVMCatalog(scope) {
+		log.Printf("Import scope does not cover every region, not disabling unseen regions")
+		return nil
+	}
+
+	result := config.DB.WithContext(ctx).Model(&models.Region{}).
+		Where("cloud = ? AND disable_flag IS NOT TRUE AND (last_seen_at IS NULL OR last_seen_at < ?)", s.cloud.Name, crawlStart).
+		Updates(map[string]interface{}{"disable_flag": true, "modified_date": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("error disabling unseen regions: %w", result.Error)
+	}
+	log.Printf("Disabled %d regions no longer listed in %s", result.RowsAffected, s.cloud.Name)
 	return nil
 }
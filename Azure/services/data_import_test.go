@@ -0,0 +1,50 @@
+package services
+
+import (
+	"cco_backend/utils"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegionSinkFinish(t *testing.T) {
+	crawlStart := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		env       map[string]string
+		disabling bool
+	}{
+		{"full crawl", nil, true},
+		{"VMs and more", map[string]string{"AZURE_PRICE_SERVICES": "Virtual Machines,Storage"}, true},
+		{"narrowed services", map[string]string{"AZURE_PRICE_SERVICES": "Storage"}, false},
+		{"region list", map[string]string{"AZURE_PRICE_REGIONS": "eastus"}, false},
+		{"raw filter", map[string]string{"AZURE_PRICE_FILTER": "productName eq 'x'"}, false},
+		{"effective dates", map[string]string{"AZURE_PRICE_EFFECTIVE_FROM": "2024-01-01"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"AZURE_PRICE_SERVICES", "AZURE_PRICE_REGIONS", "AZURE_PRICE_FILTER", "AZURE_PRICE_EFFECTIVE_FROM", "AZURE_PRICE_EFFECTIVE_TO"} {
+				t.Setenv(key, tt.env[key])
+			}
+			_, recorder := dryRunDB(t)
+
+			sink := &regionSink{cloud: utils.Cloud{Name: "AzurePublic"}}
+			if err := sink.Finish(context.Background(), crawlStart); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.disabling {
+				if len(recorder.statements) != 0 {
+					t.Errorf("narrowed crawl ran %v", recorder.statements)
+				}
+				return
+			}
+			sql := recorder.last(t)
+			if !strings.Contains(sql, `UPDATE "regions" SET "disable_flag"=true`) ||
+				!strings.Contains(sql, "cloud = 'AzurePublic' AND disable_flag IS NOT TRUE AND (last_seen_at IS NULL OR last_seen_at < '2024-06-01 00:00:00')") {
+				t.Errorf("unexpected statement %s", sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"cco_backend/models"
+	"cco_backend/retailprices"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upsertMetersAndProducts writes the meter and product of every item, including items
+// whose SKU has not been imported, so the descriptive fields of the feed are kept
+// even when no price row is written for them
+func upsertMetersAndProducts(tx *gorm.DB, items []retailprices.PriceItem) error {
+	now := time.Now()
+	meters := make([]models.Meter, 0, len(items))
+	products := make([]models.Product, 0)
+	meterIndex := map[string]int{}
+	productIndex := map[string]int{}
+	for _, item := range items {
+		if item.MeterID == "" {
+			continue
+		}
+
+		// A statement may not update the same row twice, so later duplicates win
+		meter := models.Meter{
+			MeterID:       item.MeterID,
+			MeterName:     item.MeterName,
+			SkuName:       item.SkuName,
+			ProductID:     item.ProductID,
+			UnitOfMeasure: item.UnitOfMeasure,
+			CreatedDate:   now,
+			ModifiedDate:  now,
+		}
+		if existing, ok := meterIndex[meter.MeterID]; ok {
+			meters[existing] = meter
+		} else {
+			meterIndex[meter.MeterID] = len(meters)
+			meters = append(meters, meter)
+		}
+
+		if item.ProductID == "" {
+			continue
+		}
+		product := models.Product{
+			ProductID:     item.ProductID,
+			ProductName:   item.ProductName,
+			ServiceName:   item.ServiceName,
+			ServiceID:     item.ServiceID,
+			ServiceFamily: item.ServiceFamily,
+			CreatedDate:   now,
+			ModifiedDate:  now,
+		}
+		if existing, ok := productIndex[product.ProductID]; ok {
+			products[existing] = product
+		} else {
+			productIndex[product.ProductID] = len(products)
+			products = append(products, product)
+		}
+	}
+
+	if len(products) > 0 {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"product_name", "service_name", "service_id", "service_family", "modified_date"}),
+		}).CreateInBatches(&products, upsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("error upserting products: %w", err)
+		}
+	}
+	if len(meters) > 0 {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "meter_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"meter_name", "sku_name", "product_id", "unit_of_measure", "modified_date"}),
+		}).CreateInBatches(&meters, upsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("error upserting meters: %w", err)
+		}
+	}
+	return nil
+}
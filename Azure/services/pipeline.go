@@ -0,0 +1,172 @@
+package services
+
+import (
+	"cco_backend/retailprices"
+	"cco_backend/utils"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sink consumes the price items of every page fetched by the price pipeline
+type Sink interface {
+	// Name identifies the sink in IMPORT_SINKS and in DependsOn of other sinks
+	Name() string
+	// DependsOn lists sinks whose writes must be applied first within a batch
+	DependsOn() []string
+	// Prepare is called once before the first page is fetched
+	Prepare(ctx context.Context) error
+	// Consume writes one page of items using the page's transaction
+	Consume(tx *gorm.DB, page *retailprices.PricesPage) error
+}
+
+// Finisher is implemented by sinks that need a last pass over what every sink wrote,
+// for example to link rows that arrive in different shards. Finish runs in dependency
+// order once the whole feed has been crawled without error. crawlStart is when that
+// crawl began, in the first run of a crawl that was resumed from checkpoints, so every
+// row written by the crawl was written after it.
+type Finisher interface {
+	Finish(ctx context.Context, crawlStart time.Time) error
+}
+
+// sinkFactories holds every sink the pipeline can run, keyed by name
+var sinkFactories = map[string]func() Sink{}
+
+// RegisterSink makes a sink available to RunPipeline under name
+func RegisterSink(name string, factory func() Sink) {
+	sinkFactories[name] = factory
+}
+
+func init() {
+	RegisterSink(RegionImport, func() Sink { return &regionSink{} })
+	RegisterSink(SkuImport, func() Sink { return &skuSink{} })
+	RegisterSink(PriceImport, func() Sink { return &priceSink{} })
+	RegisterSink(TermImport, func() Sink { return &termSink{} })
+}
+
+// SinksFromEnv returns the sink names listed in IMPORT_SINKS (comma separated),
+// or nil to run every registered sink
+func SinksFromEnv() []string {
+	return splitList(os.Getenv("IMPORT_SINKS"))
+}
+
+// RunPipeline crawls the price feed once and hands every page to the selected sinks in
+// dependency order. With no names every registered sink runs. A dependency that is not
+// selected is expected to have been filled by an earlier run. The feed is split into
+// shards (see planShards) that are crawled by IMPORT_WORKERS workers in parallel, the
+// primary currency before the others.
+// The run stops once ctx is done or IMPORT_RUN_TIMEOUT has passed, after committing the
+// page being written at that moment.
+func RunPipeline(ctx context.Context, names ...string) error {
+	sinks, err := orderSinks(names)
+	if err != nil {
+		return err
+	}
+
+	if timeout, err := time.ParseDuration(os.Getenv("IMPORT_RUN_TIMEOUT")); err == nil && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	sinkNames := make([]string, len(sinks))
+	for i, sink := range sinks {
+		sinkNames[i] = sink.Name()
+		if err := sink.Prepare(ctx); err != nil {
+			return fmt.Errorf("error preparing %s sink: %w", sink.Name(), err)
+		}
+	}
+	log.Printf("Running price pipeline with sinks: %s", strings.Join(sinkNames, ", "))
+
+	// A run with a single sink shares the checkpoints of that sink's importer
+	phases, err := planShards(strings.Join(sinkNames, "+"))
+	if err != nil {
+		return err
+	}
+	crawlStart, err := crawlStartedAt(ctx, phases)
+	if err != nil {
+		return err
+	}
+	// Each import run gets its own retry allowance
+	utils.ResetRetryBudget()
+	for _, shards := range phases {
+		err = crawlShards(ctx, shards, shardWorkers(), func(tx *gorm.DB, page *retailprices.PricesPage) error {
+			for _, sink := range sinks {
+				if err := sink.Consume(tx, page); err != nil {
+					return fmt.Errorf("%s sink: %w", sink.Name(), err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sink := range sinks {
+		if finisher, ok := sink.(Finisher); ok {
+			if err := finisher.Finish(ctx, crawlStart); err != nil {
+				return fmt.Errorf("error finishing %s sink: %w", sink.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// orderSinks instantiates the named sinks and sorts them so that every sink comes after
+// the selected sinks it depends on
+func orderSinks(names []string) ([]Sink, error) {
+	if len(names) == 0 {
+		for name := range sinkFactories {
+			names = append(names, name)
+		}
+	}
+	// Sort first so the resulting order does not depend on map iteration
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	selected := map[string]Sink{}
+	for _, name := range names {
+		factory, ok := sinkFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sink %q", name)
+		}
+		selected[name] = factory()
+	}
+
+	var ordered []Sink
+	state := map[string]int{} // 1 = visiting, 2 = done
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("sink dependency cycle at %q", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range selected[name].DependsOn() {
+			if _, ok := selected[dep]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, selected[name])
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"cco_backend/retailprices"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// stubSink is a sink that only declares its dependencies
+type stubSink struct {
+	name string
+	deps []string
+}
+
+func (s *stubSink) Name() string                                             { return s.name }
+func (s *stubSink) DependsOn() []string                                      { return s.deps }
+func (s *stubSink) Prepare(ctx context.Context) error                        { return nil }
+func (s *stubSink) Consume(tx *gorm.DB, page *retailprices.PricesPage) error { return nil }
+
+// withSinks replaces the registered sinks for the test
+func withSinks(t *testing.T, deps map[string][]string) {
+	saved := sinkFactories
+	t.Cleanup(func() { sinkFactories = saved })
+	sinkFactories = map[string]func() Sink{}
+	for name, d := range deps {
+		name, d := name, d
+		RegisterSink(name, func() Sink { return &stubSink{name: name, deps: d} })
+	}
+}
+
+func sinkNames(sinks []Sink) []string {
+	names := make([]string, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink.Name()
+	}
+	return names
+}
+
+func TestOrderSinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		deps     map[string][]string
+		selected []string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "dependencies first",
+			deps:     map[string][]string{"a": {"c"}, "b": {"a"}, "c": nil},
+			selected: []string{"b", "c", "a"},
+			want:     []string{"c", "a", "b"},
+		},
+		{
+			name: "every registered sink when none are selected",
+			deps: map[string][]string{"a": {"c"}, "b": {"a"}, "c": nil},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			name:     "unselected dependencies are skipped",
+			deps:     map[string][]string{"a": nil, "b": {"a"}, "c": {"b"}},
+			selected: []string{"c", "a"},
+			want:     []string{"a", "c"},
+		},
+		{
+			name:     "independent sinks in name order",
+			deps:     map[string][]string{"z": nil, "m": nil, "a": nil},
+			selected: []string{"z", "a", "m"},
+			want:     []string{"a", "m", "z"},
+		},
+		{
+			name:     "cycle",
+			deps:     map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			selected: []string{"a", "b", "c"},
+			wantErr:  "sink dependency cycle",
+		},
+		{
+			name:     "unknown sink",
+			deps:     map[string][]string{"a": nil},
+			selected: []string{"a", "missing"},
+			wantErr:  `unknown sink "missing"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSinks(t, tt.deps)
+			sinks, err := orderSinks(tt.selected)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sinkNames(sinks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderSinksDefaultRegistry(t *testing.T) {
+	sinks, err := orderSinks(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{RegionImport, SkuImport, PriceImport, TermImport}
+	if got := sinkNames(sinks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,87 +1,57 @@
 package services
 
 import (
-	"cco_backend/config"
-	"cco_backend/models"
+	"cco_backend/retailprices"
 	"cco_backend/utils"
-	"fmt"
+	"context"
 	"log"
-	"time"
-)
-
-func ImportPricesData() error {
-	// Prices API URL (Initial URL to start fetching)
-	priceApiUrl := "https://prices.azure.com/api/retail/prices?api-version=2023-01-01-preview&$filter=serviceName%20eq%20%27Virtual%20Machines%27"
 
-	// Loop to handle pagination
-	for {
-		// Fetch price data
-		priceData, err := utils.FetchData(priceApiUrl)
-		if err != nil {
-			return fmt.Errorf("error fetching price data: %w", err)
-		}
+	"gorm.io/gorm"
+)
 
-		// Parse price items from the response
-		priceItems, ok := priceData["Items"].([]interface{})
-		if !ok {
-			return fmt.Errorf("invalid format for price items")
-		}
+func ImportPricesData(ctx context.Context) error {
+	if err := RunPipeline(ctx, PriceImport); err != nil {
+		return err
+	}
 
-		// Iterate over each price item
-		for _, priceItemInterface := range priceItems {
-			priceItem := priceItemInterface.(map[string]interface{})
+	log.Println("Prices data import completed successfully.")
+	return nil
+}
 
-			// Extract required fields from the API response
-			skuID, _ := priceItem["skuId"].(string)
-			retailPrice, _ := priceItem["retailPrice"].(float64)
-			unitOfMeasure, _ := priceItem["unitOfMeasure"].(string)
-			effectiveStartDate, _ := priceItem["effectiveStartDate"].(string)
+// priceSink upserts the meter and product of every item, and a Price row for every item
+// whose SKU has been imported
+type priceSink struct {
+	regions *regionCache // region IDs of the run's cloud by region code
+}
 
-			// Find the corresponding SKU in the database
-			sku := models.Sku{}
-			if err := config.DB.Where("sku_id_api = ?", skuID).First(&sku).Error; err != nil {
-				log.Printf("SKU not found for skuId: %s, skipping...", skuID)
-				continue
-			}
+func (s *priceSink) Name() string        { return PriceImport }
+func (s *priceSink) DependsOn() []string { return []string{SkuImport} }
 
-			// Parse the effective start date
-			effectiveDate, err := time.Parse(time.RFC3339, effectiveStartDate)
-			if err != nil {
-				log.Printf("Invalid effective start date for skuId: %s, skipping...", skuID)
-				continue
-			}
+func (s *priceSink) Prepare(ctx context.Context) error {
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return err
+	}
+	s.regions = newRegionCache(cloud.Name)
+	return nil
+}
 
-			// Create a new Price entry
-			price := models.Price{
-				SkuID:        int(sku.ID),        // Foreign key referencing SKU table
-				RetailPrice:  retailPrice,         // Retail price
-				Unit:         unitOfMeasure,       // Unit of measurement
-				EffectiveDate: effectiveDate,      // Effective date for the price
-				CreatedAt:     time.Now(),         // Current timestamp for created date
-				ModifiedAt:    time.Now(),         // Current timestamp for modified date
-				DisableFlag:   false,              // Disable flag (defaults to false)
-			}
+func (s *priceSink) Consume(tx *gorm.DB, page *retailprices.PricesPage) error {
+	if err := upsertMetersAndProducts(tx, page.Items); err != nil {
+		return err
+	}
 
-			// Insert the Price into the database
-			result := config.DB.Create(&price)
-			if result.Error != nil {
-				log.Printf("Error inserting price for skuId: %s, error: %v", skuID, result.Error)
-			} else {
-				log.Printf("Price inserted successfully for skuId: %s with retail price: %.6f", skuID, retailPrice)
-			}
-		}
+	written, err := upsertPrices(tx, s.regions, page, page.Items)
+	if err != nil {
+		return err
+	}
 
-		// Check for the next page using the NextPageLink field
-		nextPageLink, exists := priceData["NextPageLink"].(string)
-		if !exists || nextPageLink == "" {
-			log.Println("All pages fetched successfully.")
-			break
+	count := 0
+	for _, price := range written {
+		if price != nil {
+			count++
 		}
-
-		// Update the API URL to the next page URL for the next iteration
-		priceApiUrl = nextPageLink
 	}
-
-	log.Println("Prices data import completed successfully.")
+	log.Printf("Upserted prices for %d of %d items", count, len(page.Items))
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"cco_backend/retailprices"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FindPrices returns the prices of a SKU quoted in a single currency, newest first.
+// Rows of other currencies are never mixed in.
+func FindPrices(ctx context.Context, skuID uint, currency string) ([]models.Price, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return nil, fmt.Errorf("currency is required")
+	}
+
+	var prices []models.Price
+	err := config.DB.WithContext(ctx).
+		Where("sku_id = ? AND currency_code = ?", skuID, currency).
+		Order("effective_date DESC").
+		Find(&prices).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s prices for SKU %d: %w", currency, skuID, err)
+	}
+	return prices, nil
+}
+
+// PriceCurrencies returns the currencies prices have been imported in
+func PriceCurrencies(ctx context.Context) ([]string, error) {
+	var currencies []string
+	if err := config.DB.WithContext(ctx).Model(&models.Price{}).Distinct().Order("currency_code").Pluck("currency_code", &currencies).Error; err != nil {
+		return nil, fmt.Errorf("error loading price currencies: %w", err)
+	}
+	return currencies, nil
+}
+
+// PriceFilter narrows a price lookup down by the class of the prices (see
+// retailprices.ClassifyVMPrice). Empty fields match every price.
+type PriceFilter struct {
+	PriceType       string // Consumption, Reservation or DevTestConsumption
+	OperatingSystem string // Linux or Windows
+	LicenseModel    string // LicenseIncluded or NotIncluded
+	Priority        string // Regular, Spot or LowPriority
+	DevTestEligible *bool
+}
+
+func (f PriceFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.PriceType != "" {
+		db = db.Where("prices.price_type = ?", f.PriceType)
+	}
+	if f.OperatingSystem != "" {
+		db = db.Where("prices.operating_system = ?", f.OperatingSystem)
+	}
+	if f.LicenseModel != "" {
+		db = db.Where("prices.license_model = ?", f.LicenseModel)
+	}
+	if f.Priority != "" {
+		db = db.Where("prices.priority = ?", f.Priority)
+	}
+	if f.DevTestEligible != nil {
+		db = db.Where("prices.dev_test_eligible = ?", *f.DevTestEligible)
+	}
+	return db
+}
+
+// FindPriceInEffect returns the prices in effect on date for an ARM SKU name (e.g.
+// Standard_D8s_v5) in a region, for a price type (Consumption, Reservation or
+// DevTestConsumption) and currency. A SKU usually has several meters, for example
+// Linux and Windows, tiered meters have one price per tier and reservations one price
+// per term, so a list is returned.
+func FindPriceInEffect(ctx context.Context, armSkuName, regionCode, priceType, currency string, date time.Time) ([]models.Price, error) {
+	return FindFilteredPrices(ctx, armSkuName, regionCode, currency, date, PriceFilter{PriceType: priceType})
+}
+
+// FindFilteredPrices returns the prices in effect on date for an ARM SKU name in a
+// region and currency that match filter, e.g. only the regular Linux consumption price:
+//
+//	PriceFilter{PriceType: "Consumption", OperatingSystem: "Linux", Priority: "Regular"}
+func FindFilteredPrices(ctx context.Context, armSkuName, regionCode, currency string, date time.Time, filter PriceFilter) ([]models.Price, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return nil, fmt.Errorf("currency is required")
+	}
+
+	var prices []models.Price
+	query := config.DB.WithContext(ctx).
+		Joins("JOIN skus ON skus.id = prices.sku_id").
+		Joins("JOIN regions ON regions.region_id = skus.region_id").
+		Where("skus.armskuname = ? AND regions.region_code = ?", armSkuName, regionCode).
+		Where("prices.currency_code = ?", currency).
+		Where("prices.effective_date <= ?", date).
+		Where("prices.effective_end_date IS NULL OR prices.effective_end_date > ?", date)
+	err := filter.apply(query).
+		Order("prices.meter_id, prices.reservation_term, prices.tier_minimum_units").
+		Find(&prices).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading prices of %s in %s on %s: %w", armSkuName, regionCode, date.Format("2006-01-02"), err)
+	}
+	return prices, nil
+}
+
+// SkuRates are the hourly rates of one on-demand meter of a SKU next to its savings plan
+// and reservation rates. A rate is nil when the meter is not offered with that term.
+type SkuRates struct {
+	PriceID              uint     `gorm:"column:price_id"` // on-demand price
+	MeterID              string   `gorm:"column:meter_id"`
+	MeterName            string   `gorm:"column:meter_name"`
+	ProductName          string   `gorm:"column:product_name"`
+	OperatingSystem      string   `gorm:"column:operating_system"`
+	LicenseModel         string   `gorm:"column:license_model"`
+	Priority             string   `gorm:"column:priority"`
+	DevTestEligible      bool     `gorm:"column:dev_test_eligible"`
+	TierMinimumUnits     float64  `gorm:"column:tier_minimum_units"`
+	Unit                 string   `gorm:"column:unit"`
+	CurrencyCode         string   `gorm:"column:currency_code"`
+	OnDemand             float64  `gorm:"column:on_demand"`
+	SavingsPlan1Year     *float64 `gorm:"column:savings_plan_1_year"`
+	SavingsPlan3Years    *float64 `gorm:"column:savings_plan_3_years"`
+	Reservation1Year     *float64 `gorm:"column:reservation_1_year"`  // upfront total spread over the term's hours
+	Reservation3Years    *float64 `gorm:"column:reservation_3_years"` // upfront total spread over the term's hours
+	SavingsPlan1YearPct  *float64 `gorm:"column:savings_plan_1_year_pct"`
+	SavingsPlan3YearsPct *float64 `gorm:"column:savings_plan_3_years_pct"`
+	Reservation1YearPct  *float64 `gorm:"column:reservation_1_year_pct"`
+	Reservation3YearsPct *float64 `gorm:"column:reservation_3_years_pct"`
+}
+
+// FindSkuRates returns the on-demand rates in effect now of an ARM SKU name in a region,
+// one row per meter and tier, with the 1 and 3 year savings plan and reservation rates
+// linked to each. Reservations only cover compute, so they only appear next to the
+// meter they were linked to (see LinkReservationTerms).
+func FindSkuRates(ctx context.Context, armSkuName, regionCode, currency string) ([]SkuRates, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return nil, fmt.Errorf("currency is required")
+	}
+
+	rate := func(purchaseOption, length, column string) string {
+		return fmt.Sprintf("MAX(CASE WHEN t.purchase_option = '%s' AND t.lease_contract_length = '%s' THEN t.%s END)", purchaseOption, length, column)
+	}
+	now := time.Now()
+
+	var rates []SkuRates
+	err := config.DB.WithContext(ctx).
+		Table("prices p").
+		Select(strings.Join([]string{
+			"p.price_id, p.meter_id, COALESCE(m.meter_name, '') AS meter_name, COALESCE(s.product_name, '') AS product_name",
+			"p.operating_system, p.license_model, p.priority, p.dev_test_eligible",
+			"p.tier_minimum_units, p.unit, p.currency_code, p.retail_price AS on_demand",
+			rate(termSavingsPlan, "1 Year", "discounted_rate") + " AS savings_plan_1_year",
+			rate(termSavingsPlan, "3 Years", "discounted_rate") + " AS savings_plan_3_years",
+			rate(termReservation, "1 Year", "discounted_rate") + " AS reservation_1_year",
+			rate(termReservation, "3 Years", "discounted_rate") + " AS reservation_3_years",
+			rate(termSavingsPlan, "1 Year", "discount_percent") + " AS savings_plan_1_year_pct",
+			rate(termSavingsPlan, "3 Years", "discount_percent") + " AS savings_plan_3_years_pct",
+			rate(termReservation, "1 Year", "discount_percent") + " AS reservation_1_year_pct",
+			rate(termReservation, "3 Years", "discount_percent") + " AS reservation_3_years_pct",
+		}, ", ")).
+		Joins("JOIN skus s ON s.id = p.sku_id").
+		Joins("JOIN regions r ON r.region_id = s.region_id").
+		Joins("LEFT JOIN meters m ON m.meter_id = p.meter_id").
+		// Terms of superseded reservation prices still point at the on-demand price
+		Joins(`LEFT JOIN (terms t JOIN prices tp ON tp.price_id = t.price_id
+			AND (tp.effective_end_date IS NULL OR tp.effective_end_date > ?)) ON t.on_demand_price_id = p.price_id`, now).
+		Where("s.armskuname = ? AND r.region_code = ? AND s.type = ?", armSkuName, regionCode, retailprices.PriceTypeConsumption).
+		Where("p.currency_code = ?", currency).
+		Where("p.effective_date <= ? AND (p.effective_end_date IS NULL OR p.effective_end_date > ?)", now, now).
+		Group("p.price_id, m.meter_name, s.product_name").
+		Order("p.operating_system, p.priority, meter_name, p.tier_minimum_units").
+		Scan(&rates).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading rates of %s in %s: %w", armSkuName, regionCode, err)
+	}
+	return rates, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindPriceInEffect(t *testing.T) {
+	_, recorder := dryRunDB(t)
+	date := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := FindPriceInEffect(context.Background(), "Standard_D8s_v5", "eastus", "Reservation", " usd ", date); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := recorder.last(t)
+	for _, want := range []string{
+		"JOIN skus ON skus.id = prices.sku_id",
+		"JOIN regions ON regions.region_id = skus.region_id",
+		"skus.armskuname = 'Standard_D8s_v5' AND regions.region_code = 'eastus'",
+		"prices.currency_code = 'USD'",
+		"prices.effective_date <= '2024-06-01 00:00:00'",
+		// Open-ended and later-ending prices are both in effect, without widening the other conditions
+		"(prices.effective_end_date IS NULL OR prices.effective_end_date > '2024-06-01 00:00:00')",
+		"prices.price_type = 'Reservation'",
+		"ORDER BY prices.meter_id, prices.reservation_term, prices.tier_minimum_units",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query lacks %q:\n%s", want, sql)
+		}
+	}
+}
+
+func TestFindPriceInEffectNeedsCurrency(t *testing.T) {
+	_, recorder := dryRunDB(t)
+	if _, err := FindPriceInEffect(context.Background(), "Standard_D8s_v5", "eastus", "Consumption", " ", time.Now()); err == nil {
+		t.Fatal("expected an error without a currency")
+	}
+	if len(recorder.statements) != 0 {
+		t.Errorf("ran %v without a currency", recorder.statements)
+	}
+}
+
+func TestPriceFilterApply(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter PriceFilter
+		want   string
+	}{
+		{"empty", PriceFilter{}, `SELECT * FROM "prices"`},
+		{"price type", PriceFilter{PriceType: "DevTestConsumption"}, `WHERE prices.price_type = 'DevTestConsumption'`},
+		{
+			"every field",
+			PriceFilter{PriceType: "Consumption", OperatingSystem: "Linux", LicenseModel: "NotIncluded", Priority: "Spot", DevTestEligible: &yes},
+			"WHERE prices.price_type = 'Consumption' AND prices.operating_system = 'Linux' AND prices.license_model = 'NotIncluded' AND prices.priority = 'Spot' AND prices.dev_test_eligible = true",
+		},
+		{"not dev/test eligible", PriceFilter{DevTestEligible: &no}, "WHERE prices.dev_test_eligible = false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, recorder := dryRunDB(t)
+			var prices []models.Price
+			if err := tt.filter.apply(config.DB.Model(&models.Price{})).Find(&prices).Error; err != nil {
+				t.Fatal(err)
+			}
+			sql := recorder.last(t)
+			if !strings.HasSuffix(sql, tt.want) {
+				t.Errorf("got %s, want it to end with %s", sql, tt.want)
+			}
+			// The type of the SKU row is not the type of its prices
+			if strings.Contains(sql, "skus.type") {
+				t.Errorf("filter uses skus.type: %s", sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"cco_backend/models"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// regionCache remembers the IDs of the regions of one cloud for the length of an import
+// run, so sinks do not query the regions table for every price item. Only regions that
+// were found are cached; a region missing now may be created by a later page.
+type regionCache struct {
+	cloud string
+
+	mu  sync.Mutex
+	ids map[string]uint
+}
+
+func newRegionCache(cloud string) *regionCache {
+	return &regionCache{cloud: cloud, ids: map[string]uint{}}
+}
+
+// lookup returns the ID of the region with the given code, reading it through tx on a
+// cache miss
+func (c *regionCache) lookup(tx *gorm.DB, regionCode string) (uint, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if id, ok := c.ids[regionCode]; ok {
+		return id, true, nil
+	}
+
+	var region models.Region
+	err := tx.Where("region_code = ? AND cloud = ?", regionCode, c.cloud).First(&region).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error finding region %s: %w", regionCode, err)
+	}
+	c.ids[regionCode] = region.RegionID
+	return region.RegionID, true, nil
+}
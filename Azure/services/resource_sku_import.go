@@ -0,0 +1,318 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"cco_backend/resourceskus"
+	"cco_backend/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImportResourceSkus reads the complete Resource SKUs list of every subscription
+// selected by config.LoadSkuImportConfig, following nextLink, and stores it. Lists are
+// fetched concurrently by IMPORT_WORKERS workers and stored one subscription at a time,
+// so the shared catalog rows are never written by two transactions at once. The SKUs
+// of all subscriptions are returned, one entry per SKU and location, so callers can
+// match against them without reading them back.
+func ImportResourceSkus(ctx context.Context) ([]resourceskus.ResourceSku, error) {
+	cfg := config.LoadSkuImportConfig()
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := skuSubscriptions(ctx, cfg, cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	type fetchedList struct {
+		subscription armSubscription
+		skus         []resourceskus.ResourceSku
+		err          error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := resourceskus.NewClient(utils.DefaultTokenProvider(), cloud.TokenScope)
+	queue := make(chan armSubscription)
+	lists := make(chan fetchedList)
+
+	workers := shardWorkers()
+	if workers > len(subscriptions) {
+		workers = len(subscriptions)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for subscription := range queue {
+				skus, err := client.ListAll(ctx, resourceskus.Query{
+					Endpoint:       cloud.ResourceManagerEndpoint,
+					SubscriptionID: subscription.SubscriptionID,
+					APIVersion:     cfg.APIVersion,
+					Location:       cfg.Location,
+				})
+				lists <- fetchedList{subscription: subscription, skus: skus, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for _, subscription := range subscriptions {
+			select {
+			case queue <- subscription:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(lists)
+	}()
+
+	// Commits must not be interrupted halfway, so they only inherit ctx's values
+	dbCtx := context.WithoutCancel(ctx)
+
+	var (
+		firstErr error
+		all      []resourceskus.ResourceSku
+		seen     = map[string]bool{}
+	)
+	for list := range lists {
+		if firstErr != nil {
+			continue
+		}
+		id := list.subscription.SubscriptionID
+		if list.err != nil {
+			firstErr = fmt.Errorf("error fetching SKU data for subscription %s: %w", id, list.err)
+			cancel()
+			continue
+		}
+		log.Printf("Fetched %d Resource SKU entries for subscription %s", len(list.skus), id)
+
+		if err := storeResourceSkus(dbCtx, id, cfg.Location, list.skus); err != nil {
+			firstErr = err
+			cancel()
+			continue
+		}
+		if err := markSubscriptionImported(dbCtx, list.subscription, cloud.Name); err != nil {
+			firstErr = err
+			cancel()
+			continue
+		}
+
+		// Subscriptions mostly see the same catalog, keep every SKU and location once
+		for _, sku := range list.skus {
+			entry := sku.ResourceType + "|" + sku.Name + "|" + sku.Tier + "|" + sku.Size + "|" + strings.Join(sku.Locations, ",")
+			if !seen[entry] {
+				seen[entry] = true
+				all = append(all, sku)
+			}
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return all, nil
+}
+
+// resourceSkuKey is the natural key of a ResourceSku row
+type resourceSkuKey struct {
+	resourceType, name, tier, size string
+}
+
+func keyOf(sku resourceskus.ResourceSku) resourceSkuKey {
+	return resourceSkuKey{sku.ResourceType, sku.Name, sku.Tier, sku.Size}
+}
+
+// storeResourceSkus upserts the SKU catalog and replaces the locations and restrictions
+// the subscription sees, limited to location when one is given, in one transaction
+func storeResourceSkus(ctx context.Context, subscriptionID, location string, skus []resourceskus.ResourceSku) error {
+	// The API repeats a SKU for every location it is offered in; the catalog keeps one row
+	rows := make([]models.ResourceSku, 0, len(skus))
+	seen := map[resourceSkuKey]bool{}
+	for _, sku := range skus {
+		key := keyOf(sku)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		rows = append(rows, models.ResourceSku{
+			ResourceType: sku.ResourceType,
+			Name:         sku.Name,
+			Tier:         sku.Tier,
+			Size:         sku.Size,
+			Family:       sku.Family,
+			Kind:         sku.Kind,
+			ModifiedDate: time.Now(),
+		})
+	}
+
+	return config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(rows) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "resource_type"}, {Name: "name"}, {Name: "tier"}, {Name: "size"}},
+				DoUpdates: clause.AssignmentColumns([]string{"family", "kind", "modified_date"}),
+			}).CreateInBatches(&rows, upsertBatchSize).Error
+			if err != nil {
+				return fmt.Errorf("error upserting resource SKUs: %w", err)
+			}
+		}
+		ids := make(map[resourceSkuKey]uint, len(rows))
+		for _, row := range rows {
+			ids[resourceSkuKey{row.ResourceType, row.Name, row.Tier, row.Size}] = row.ResourceSkuID
+		}
+
+		capabilities := skuCapabilityRows(skus, ids)
+		if len(capabilities) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "resource_sku_id"}, {Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "numeric_value", "bool_value", "modified_date"}),
+			}).CreateInBatches(&capabilities, upsertBatchSize).Error
+			if err != nil {
+				return fmt.Errorf("error upserting SKU capabilities: %w", err)
+			}
+		}
+
+		// Locations and restrictions are replaced wholesale, so ones the subscription
+		// lost since the last run disappear
+		scoped := func() *gorm.DB {
+			q := tx.Where("subscription_id = ?", subscriptionID)
+			if location != "" {
+				q = q.Where("location = ?", location)
+			}
+			return q
+		}
+		if err := scoped().Delete(&models.ResourceSkuLocation{}).Error; err != nil {
+			return fmt.Errorf("error clearing SKU locations: %w", err)
+		}
+		if err := scoped().Delete(&models.ResourceSkuRestriction{}).Error; err != nil {
+			return fmt.Errorf("error clearing SKU restrictions: %w", err)
+		}
+
+		locations, restrictions, err := skuLocationRows(subscriptionID, skus, ids)
+		if err != nil {
+			return err
+		}
+		if len(locations) > 0 {
+			if err := tx.CreateInBatches(&locations, upsertBatchSize).Error; err != nil {
+				return fmt.Errorf("error inserting SKU locations: %w", err)
+			}
+		}
+		if len(restrictions) > 0 {
+			if err := tx.CreateInBatches(&restrictions, upsertBatchSize).Error; err != nil {
+				return fmt.Errorf("error inserting SKU restrictions: %w", err)
+			}
+		}
+
+		log.Printf("Stored %d resource SKUs, %d capabilities, %d locations and %d restrictions for subscription %s",
+			len(rows), len(capabilities), len(locations), len(restrictions), subscriptionID)
+		return nil
+	})
+}
+
+// skuCapabilityRows returns one row per capability of every catalog SKU, with the
+// value parsed where it is a number or a bool
+func skuCapabilityRows(skus []resourceskus.ResourceSku, ids map[resourceSkuKey]uint) []models.SkuCapability {
+	type capabilityKey struct {
+		skuID uint
+		name  string
+	}
+	seen := map[capabilityKey]bool{}
+	var rows []models.SkuCapability
+	now := time.Now()
+
+	for _, sku := range skus {
+		skuID := ids[keyOf(sku)]
+		for _, capability := range sku.Capabilities {
+			key := capabilityKey{skuID, capability.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			number, flag := resourceskus.ParseCapabilityValue(capability.Value)
+			rows = append(rows, models.SkuCapability{
+				ResourceSkuID: skuID,
+				Name:          capability.Name,
+				Value:         capability.Value,
+				NumericValue:  number,
+				BoolValue:     flag,
+				ModifiedDate:  now,
+			})
+		}
+	}
+	return rows
+}
+
+// skuLocationRows flattens locationInfo and restrictions into one row per SKU and
+// location, and one row per restriction and location
+func skuLocationRows(subscriptionID string, skus []resourceskus.ResourceSku, ids map[resourceSkuKey]uint) ([]models.ResourceSkuLocation, []models.ResourceSkuRestriction, error) {
+	type locationKey struct {
+		skuID    uint
+		location string
+	}
+	var locations []models.ResourceSkuLocation
+	seen := map[locationKey]bool{}
+	var restrictions []models.ResourceSkuRestriction
+
+	for _, sku := range skus {
+		skuID := ids[keyOf(sku)]
+
+		for _, info := range sku.LocationInfo {
+			key := locationKey{skuID, strings.ToLower(info.Location)}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			zoneDetails := ""
+			if len(info.ZoneDetails) > 0 {
+				encoded, err := json.Marshal(info.ZoneDetails)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error encoding zone details of %s: %w", sku.Name, err)
+				}
+				zoneDetails = string(encoded)
+			}
+			locations = append(locations, models.ResourceSkuLocation{
+				ResourceSkuID:     skuID,
+				SubscriptionID:    subscriptionID,
+				Location:          key.location,
+				Zones:             strings.Join(info.Zones, ","),
+				ZoneDetails:       zoneDetails,
+				ExtendedLocations: strings.Join(info.ExtendedLocations, ","),
+			})
+		}
+
+		for _, restriction := range sku.Restrictions {
+			restricted := restriction.RestrictionInfo.Locations
+			if len(restricted) == 0 {
+				restricted = restriction.Values
+			}
+			for _, loc := range restricted {
+				restrictions = append(restrictions, models.ResourceSkuRestriction{
+					ResourceSkuID:  skuID,
+					SubscriptionID: subscriptionID,
+					Type:           restriction.Type,
+					Location:       strings.ToLower(loc),
+					Zones:          strings.Join(restriction.RestrictionInfo.Zones, ","),
+					ReasonCode:     restriction.ReasonCode,
+				})
+			}
+		}
+	}
+	return locations, restrictions, nil
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/retailprices"
+	"cco_backend/utils"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// priceTypes are the values the Retail Prices API uses for priceType
+var priceTypes = []string{retailprices.PriceTypeConsumption, retailprices.PriceTypeReservation, retailprices.PriceTypeDevTestConsumption}
+
+// shardFields are the item fields the feed can be sharded by, in filter order
+var shardFields = []string{"serviceName", "armRegionName", "priceType"}
+
+// shard is a slice of the price feed selected by an OData filter and crawled with its
+// own pagination cursor and checkpoint
+type shard struct {
+	name string // checkpoint name of the shard
+	url  string // first page of the shard
+}
+
+// planShards splits the price feed selected by config.LoadPriceImportConfig into one
+// set of shards per currency, each split along the fields listed in IMPORT_SHARD_BY
+// (armRegionName, serviceName, priceType; default priceType). Each shard gets one value
+// of every sharded field, taken from the import scope (see shardCombos). Shards query
+// the pricing endpoint of the cloud selected by AZURE_CLOUD.
+//
+// The shards are returned in two phases that are crawled one after the other: the
+// primary currency, whose pages write the SKU rows, and then every other currency, so
+// their prices find the SKUs they belong to.
+func planShards(importName string) ([][]shard, error) {
+	scope := config.LoadPriceImportConfig()
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return nil, err
+	}
+	if cloud.PricingEndpoint == "" {
+		return nil, fmt.Errorf("cloud %s has no retail prices endpoint, set AZURE_PRICE_ENDPOINT", cloud.Name)
+	}
+	scopeValues := map[string][]string{
+		"serviceName":   scope.Services,
+		"armRegionName": scope.Regions,
+		"priceType":     scope.PriceTypes,
+	}
+
+	dimensions := splitList(os.Getenv("IMPORT_SHARD_BY"))
+	if os.Getenv("IMPORT_SHARD_BY") == "" {
+		dimensions = []string{"priceType"}
+	}
+	combos, err := shardCombos(dimensions, scopeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	phases := [][]shard{currencyShards(importName, cloud.PricingEndpoint, scope, scopeValues, combos, scope.PrimaryCurrency())}
+	var others []shard
+	for _, currency := range scope.Currencies[1:] {
+		others = append(others, currencyShards(importName, cloud.PricingEndpoint, scope, scopeValues, combos, currency)...)
+	}
+	if len(others) > 0 {
+		phases = append(phases, others)
+	}
+	return phases, nil
+}
+
+// shardCombos expands the sharded dimensions into one field combination per shard,
+// taking the values of each dimension from the import scope. Sharding by priceType
+// without a configured list uses every price type. Other dimensions need their list:
+// shards only cover the values they are built from, so sharding by armRegionName
+// without AZURE_PRICE_REGIONS would never crawl a region that is not known yet.
+func shardCombos(dimensions []string, scopeValues map[string][]string) ([]map[string]string, error) {
+	combos := []map[string]string{{}}
+	for _, dimension := range dimensions {
+		values, ok := scopeValues[dimension]
+		if !ok {
+			return nil, fmt.Errorf("unknown shard dimension %q", dimension)
+		}
+		if len(values) == 0 {
+			if dimension != "priceType" {
+				return nil, fmt.Errorf("sharding by %s needs the list of values to crawl, e.g. AZURE_PRICE_REGIONS for armRegionName", dimension)
+			}
+			values = priceTypes
+		}
+
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, value := range values {
+				extended := map[string]string{dimension: value}
+				for field, existing := range combo {
+					extended[field] = existing
+				}
+				next = append(next, extended)
+			}
+		}
+		combos = next
+	}
+	return combos, nil
+}
+
+// currencyShards builds the shards of every field combination for one currency
+func currencyShards(importName, endpoint string, scope config.PriceImportConfig, scopeValues map[string][]string, combos []map[string]string, currency string) []shard {
+	shards := make([]shard, 0, len(combos))
+	for _, combo := range combos {
+		filters := make([]retailprices.Filter, 0, len(shardFields)+2)
+		nameParts := []string{currency}
+		for _, field := range shardFields {
+			if value, ok := combo[field]; ok {
+				filters = append(filters, retailprices.Eq(field, value))
+				nameParts = append(nameParts, value)
+			} else {
+				filters = append(filters, retailprices.In(field, scopeValues[field]...))
+			}
+		}
+		filters = append(filters,
+			retailprices.EffectiveBetween(scope.EffectiveFrom, scope.EffectiveTo),
+			retailprices.Raw(scope.ExtraFilter),
+		)
+
+		query := retailprices.Query{
+			Endpoint:     endpoint,
+			APIVersion:   scope.APIVersion,
+			CurrencyCode: currency,
+			Filter:       retailprices.And(filters...),
+		}
+
+		name := importName + "@" + strings.Join(nameParts, "/")
+		shards = append(shards, shard{name: name, url: query.URL()})
+	}
+	return shards
+}
+
+// shardWorkers returns the number of shards crawled at the same time, from IMPORT_WORKERS
+func shardWorkers() int {
+	if workers, err := strconv.Atoi(os.Getenv("IMPORT_WORKERS")); err == nil && workers > 0 {
+		return workers
+	}
+	return 4
+}
+
+// crawlShards crawls every shard with a bounded pool of workers. Pages are fetched
+// concurrently but committed one at a time, each in a transaction that also advances
+// its shard's checkpoint, so a restarted run continues every shard after its last
+// committed page. The first error, or ctx being done, stops all workers; the page being
+// committed at that moment is still committed.
+func crawlShards(ctx context.Context, shards []shard, workers int, handle pageHandler) error {
+	type fetchedPage struct {
+		shard   shard
+		page    *retailprices.PricesPage
+		pageNum int
+		next    string
+	}
+
+	client := retailprices.NewClient()
+	queue := make(chan shard)
+	pages := make(chan fetchedPage, workers)
+	stop := make(chan struct{})
+
+	var (
+		errMu    sync.Mutex
+		firstErr error
+		stopOnce sync.Once
+	)
+	fail := func(err error) {
+		errMu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMu.Unlock()
+		stopOnce.Do(func() { close(stop) })
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range queue {
+				startURL, pagesDone, err := resumePoint(ctx, s.name, s.url)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if startURL == "" {
+					continue
+				}
+
+				pager := client.ResumePager(ctx, startURL, pagesDone)
+				for pager.Next() {
+					select {
+					case pages <- fetchedPage{shard: s, page: pager.Page(), pageNum: pager.PageNumber(), next: pager.NextPageLink()}:
+					case <-stop:
+						return
+					case <-ctx.Done():
+						fail(ctx.Err())
+						return
+					}
+				}
+				if err := pager.Err(); err != nil {
+					fail(fmt.Errorf("error fetching price data for %s: %w", s.name, err))
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for _, s := range shards {
+			select {
+			case queue <- s:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+
+	// Commits must not be interrupted halfway, so they only inherit ctx's values
+	dbCtx := context.WithoutCancel(ctx)
+
+	// Commit pages as they arrive; after a failure keep draining so workers can exit
+	for fetched := range pages {
+		if err := ctx.Err(); err != nil {
+			fail(err)
+		}
+		select {
+		case <-stop:
+			continue
+		default:
+		}
+
+		err := config.DB.WithContext(dbCtx).Transaction(func(tx *gorm.DB) error {
+			if err := handle(tx, fetched.page); err != nil {
+				return err
+			}
+			return saveCheckpoint(tx, fetched.shard.name, fetched.shard.url, fetched.next, fetched.pageNum)
+		})
+		if err != nil {
+			fail(fmt.Errorf("error importing page %d of %s: %w", fetched.pageNum, fetched.shard.name, err))
+			continue
+		}
+		log.Printf("%s: committed page %d", fetched.shard.name, fetched.pageNum)
+	}
+
+	if firstErr != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("import stopped, committed pages are kept in the checkpoints: %w", firstErr)
+		}
+		return firstErr
+	}
+
+	// The run is complete, so the next one starts every shard from its first page
+	for _, s := range shards {
+		if err := ResetCheckpoint(ctx, s.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated environment value, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
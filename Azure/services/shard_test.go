@@ -0,0 +1,192 @@
+package services
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShardCombos(t *testing.T) {
+	scope := map[string][]string{
+		"serviceName":   {"Virtual Machines"},
+		"armRegionName": {"eastus", "westeurope"},
+		"priceType":     nil,
+	}
+	tests := []struct {
+		name       string
+		dimensions []string
+		scope      map[string][]string
+		want       []map[string]string
+		wantErr    string
+	}{
+		{
+			name: "no dimensions is one shard",
+			want: []map[string]string{{}},
+		},
+		{
+			name:       "price types default to every type",
+			dimensions: []string{"priceType"},
+			want:       []map[string]string{{"priceType": "Consumption"}, {"priceType": "Reservation"}, {"priceType": "DevTestConsumption"}},
+		},
+		{
+			name:       "configured price types",
+			dimensions: []string{"priceType"},
+			scope:      map[string][]string{"priceType": {"Reservation"}},
+			want:       []map[string]string{{"priceType": "Reservation"}},
+		},
+		{
+			name:       "regions by price type",
+			dimensions: []string{"armRegionName", "priceType"},
+			scope:      map[string][]string{"armRegionName": {"eastus", "westeurope"}, "priceType": {"Consumption", "Reservation"}},
+			want: []map[string]string{
+				{"armRegionName": "eastus", "priceType": "Consumption"},
+				{"armRegionName": "eastus", "priceType": "Reservation"},
+				{"armRegionName": "westeurope", "priceType": "Consumption"},
+				{"armRegionName": "westeurope", "priceType": "Reservation"},
+			},
+		},
+		{
+			name:       "services",
+			dimensions: []string{"serviceName"},
+			want:       []map[string]string{{"serviceName": "Virtual Machines"}},
+		},
+		{
+			name:       "regions need a list",
+			dimensions: []string{"armRegionName"},
+			scope:      map[string][]string{"armRegionName": nil},
+			wantErr:    "AZURE_PRICE_REGIONS",
+		},
+		{
+			name:       "unknown dimension",
+			dimensions: []string{"productName"},
+			wantErr:    `unknown shard dimension "productName"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string][]string{}
+			for field, list := range scope {
+				values[field] = list
+			}
+			for field, list := range tt.scope {
+				values[field] = list
+			}
+
+			combos, err := shardCombos(tt.dimensions, values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(combos, tt.want) {
+				t.Errorf("got %v, want %v", combos, tt.want)
+			}
+		})
+	}
+}
+
+// shardQuery returns the currency and filter a shard's first page is requested with
+func shardQuery(t *testing.T, s shard) (currency, filter string) {
+	t.Helper()
+	u, err := url.Parse(s.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("currencyCode"), u.Query().Get("$filter")
+}
+
+func TestPlanShardsCurrencyPhases(t *testing.T) {
+	for key, value := range map[string]string{
+		"AZURE_CLOUD":                "",
+		"AZURE_PRICE_ENDPOINT":       "",
+		"AZURE_PRICE_SERVICES":       "",
+		"AZURE_PRICE_REGIONS":        "eastus,westeurope",
+		"AZURE_PRICE_TYPES":          "Consumption,Reservation",
+		"AZURE_PRICE_CURRENCIES":     "EUR,USD,GBP",
+		"AZURE_PRICE_FILTER":         "",
+		"AZURE_PRICE_EFFECTIVE_FROM": "",
+		"AZURE_PRICE_EFFECTIVE_TO":   "",
+		"IMPORT_SHARD_BY":            "armRegionName",
+	} {
+		t.Setenv(key, value)
+	}
+
+	phases, err := planShards("prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(phases) != 2 {
+		t.Fatalf("got %d phases, want the primary currency and then the others", len(phases))
+	}
+
+	var names [][]string
+	for _, phase := range phases {
+		var phaseNames []string
+		for _, s := range phase {
+			phaseNames = append(phaseNames, s.name)
+		}
+		names = append(names, phaseNames)
+	}
+	want := [][]string{
+		{"prices@EUR/eastus", "prices@EUR/westeurope"},
+		{"prices@USD/eastus", "prices@USD/westeurope", "prices@GBP/eastus", "prices@GBP/westeurope"},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got shards %v, want %v", names, want)
+	}
+
+	for _, phase := range phases {
+		for _, s := range phase {
+			currency, filter := shardQuery(t, s)
+			region := s.name[strings.LastIndex(s.name, "/")+1:]
+			if !strings.HasPrefix(s.url, "https://prices.azure.com/") || "prices@"+strings.Trim(currency, "'")+"/"+region != s.name {
+				t.Errorf("%s: requested %s", s.name, s.url)
+			}
+			// Unsharded fields keep the scope's lists
+			for _, part := range []string{
+				"serviceName eq 'Virtual Machines'",
+				"armRegionName eq '" + region + "'",
+				"priceType eq 'Consumption' or priceType eq 'Reservation'",
+			} {
+				if !strings.Contains(filter, part) {
+					t.Errorf("%s: filter %q lacks %q", s.name, filter, part)
+				}
+			}
+		}
+	}
+}
+
+func TestPlanShardsSingleCurrency(t *testing.T) {
+	t.Setenv("AZURE_CLOUD", "")
+	t.Setenv("AZURE_PRICE_ENDPOINT", "")
+	t.Setenv("AZURE_PRICE_REGIONS", "")
+	t.Setenv("AZURE_PRICE_TYPES", "")
+	t.Setenv("AZURE_PRICE_CURRENCIES", "")
+	t.Setenv("AZURE_PRICE_CURRENCY", "")
+	t.Setenv("IMPORT_SHARD_BY", "")
+
+	phases, err := planShards("prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(phases) != 1 || len(phases[0]) != len(priceTypes) {
+		t.Fatalf("got %v, want one USD phase split by price type", phases)
+	}
+	for i, s := range phases[0] {
+		if currency, _ := shardQuery(t, s); currency != "'USD'" || s.name != "prices@USD/"+priceTypes[i] {
+			t.Errorf("shard %s requests %s", s.name, s.url)
+		}
+	}
+
+	// Regions are only sharded from a list
+	t.Setenv("IMPORT_SHARD_BY", "armRegionName")
+	if _, err := planShards("prices"); err == nil {
+		t.Error("expected an error sharding by region without AZURE_PRICE_REGIONS")
+	}
+}
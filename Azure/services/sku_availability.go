@@ -0,0 +1,164 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Reason codes of SkuAvailability besides the ones the API reports in restrictions
+// (NotAvailableForSubscription, QuotaId)
+const (
+	ReasonNotOfferedInLocation = "NotOfferedInLocation"
+	ReasonNoZones              = "NoAvailabilityZones"
+	ReasonNotOfferedInZone     = "NotOfferedInZone"
+)
+
+// SkuAvailability tells whether a SKU can be deployed by a subscription in a location,
+// or in one zone of it, and why not when it cannot
+type SkuAvailability struct {
+	ResourceSkuID  uint
+	Name           string
+	SubscriptionID string
+	Location       string
+	Zone           string   // requested zone, empty for a regional deployment
+	Zones          []string // zones the SKU is offered in at the location
+	Available      bool
+	ReasonCode     string // empty when available
+	Reason         string // human readable explanation, empty when available
+}
+
+// FindSkuAvailability returns the deployability of every virtual machine SKU in
+// location, and in zone when it is not empty, for subscriptionID. The answer is based
+// on the Resource SKUs list last imported for that subscription.
+func FindSkuAvailability(ctx context.Context, subscriptionID, location, zone string) ([]SkuAvailability, error) {
+	return findSkuAvailability(ctx, subscriptionID, location, zone, "")
+}
+
+// FindDeployableSkus returns only the SKUs FindSkuAvailability reports as available
+func FindDeployableSkus(ctx context.Context, subscriptionID, location, zone string) ([]SkuAvailability, error) {
+	all, err := FindSkuAvailability(ctx, subscriptionID, location, zone)
+	if err != nil {
+		return nil, err
+	}
+	deployable := all[:0]
+	for _, availability := range all {
+		if availability.Available {
+			deployable = append(deployable, availability)
+		}
+	}
+	return deployable, nil
+}
+
+// CheckSkuAvailability answers the question for a single SKU name, e.g. whether
+// Standard_D8s_v5 can be deployed in westeurope zone 3
+func CheckSkuAvailability(ctx context.Context, subscriptionID, name, location, zone string) (SkuAvailability, error) {
+	result, err := findSkuAvailability(ctx, subscriptionID, location, zone, name)
+	if err != nil {
+		return SkuAvailability{}, err
+	}
+	if len(result) == 0 {
+		return SkuAvailability{}, fmt.Errorf("unknown virtual machine SKU %s", name)
+	}
+	return result[0], nil
+}
+
+func findSkuAvailability(ctx context.Context, subscriptionID, location, zone, name string) ([]SkuAvailability, error) {
+	location = strings.ToLower(strings.TrimSpace(location))
+	zone = strings.TrimSpace(zone)
+	if subscriptionID == "" || location == "" {
+		return nil, fmt.Errorf("subscription and location are required")
+	}
+	db := config.DB.WithContext(ctx)
+
+	skuQuery := db.Where("resource_type = ?", "virtualMachines")
+	if name != "" {
+		skuQuery = skuQuery.Where("name = ?", name)
+	}
+	var skus []models.ResourceSku
+	if err := skuQuery.Find(&skus).Error; err != nil {
+		return nil, fmt.Errorf("error loading resource SKUs: %w", err)
+	}
+
+	var locations []models.ResourceSkuLocation
+	if err := db.Where("subscription_id = ? AND location = ?", subscriptionID, location).Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("error loading SKU locations: %w", err)
+	}
+	offered := make(map[uint]models.ResourceSkuLocation, len(locations))
+	for _, row := range locations {
+		offered[row.ResourceSkuID] = row
+	}
+
+	var restrictionRows []models.ResourceSkuRestriction
+	if err := db.Where("subscription_id = ? AND location = ?", subscriptionID, location).Find(&restrictionRows).Error; err != nil {
+		return nil, fmt.Errorf("error loading SKU restrictions: %w", err)
+	}
+	restrictions := map[uint][]models.ResourceSkuRestriction{}
+	for _, row := range restrictionRows {
+		restrictions[row.ResourceSkuID] = append(restrictions[row.ResourceSkuID], row)
+	}
+
+	result := make([]SkuAvailability, 0, len(skus))
+	for _, sku := range skus {
+		availability := SkuAvailability{
+			ResourceSkuID:  sku.ResourceSkuID,
+			Name:           sku.Name,
+			SubscriptionID: subscriptionID,
+			Location:       location,
+			Zone:           zone,
+		}
+		offeredAt, ok := offered[sku.ResourceSkuID]
+		if ok {
+			availability.Zones = splitList(offeredAt.Zones)
+		}
+		explainAvailability(&availability, ok, restrictions[sku.ResourceSkuID])
+		result = append(result, availability)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// explainAvailability decides whether the SKU is deployable. A location restriction
+// wins over everything else, since the API keeps listing restricted SKUs with their
+// zones; zone checks only apply when a zone was asked for.
+func explainAvailability(a *SkuAvailability, offered bool, restrictions []models.ResourceSkuRestriction) {
+	for _, restriction := range restrictions {
+		if restriction.Type == "Location" {
+			a.ReasonCode = restriction.ReasonCode
+			a.Reason = fmt.Sprintf("%s is restricted in %s for subscription %s (%s)", a.Name, a.Location, a.SubscriptionID, restriction.ReasonCode)
+			return
+		}
+	}
+	if !offered {
+		a.ReasonCode = ReasonNotOfferedInLocation
+		a.Reason = fmt.Sprintf("%s is not offered in %s", a.Name, a.Location)
+		return
+	}
+
+	if a.Zone != "" {
+		if len(a.Zones) == 0 {
+			a.ReasonCode = ReasonNoZones
+			a.Reason = fmt.Sprintf("%s has no availability zones in %s", a.Name, a.Location)
+			return
+		}
+		if !slices.Contains(a.Zones, a.Zone) {
+			a.ReasonCode = ReasonNotOfferedInZone
+			a.Reason = fmt.Sprintf("%s is not offered in %s zone %s, only in zones %s", a.Name, a.Location, a.Zone, strings.Join(a.Zones, ", "))
+			return
+		}
+		for _, restriction := range restrictions {
+			if restriction.Type == "Zone" && slices.Contains(splitList(restriction.Zones), a.Zone) {
+				a.ReasonCode = restriction.ReasonCode
+				a.Reason = fmt.Sprintf("%s is restricted in %s zone %s for subscription %s (%s)", a.Name, a.Location, a.Zone, a.SubscriptionID, restriction.ReasonCode)
+				return
+			}
+		}
+	}
+
+	a.Available = true
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"cco_backend/models"
+	"strings"
+	"testing"
+)
+
+func TestExplainAvailability(t *testing.T) {
+	locationRestriction := models.ResourceSkuRestriction{Type: "Location", Location: "westeurope", ReasonCode: "NotAvailableForSubscription"}
+	zoneRestriction := models.ResourceSkuRestriction{Type: "Zone", Location: "westeurope", Zones: "2,3", ReasonCode: "NotAvailableForSubscription"}
+
+	tests := []struct {
+		name         string
+		zone         string
+		zones        []string
+		offered      bool
+		restrictions []models.ResourceSkuRestriction
+		wantCode     string
+		wantReason   string
+	}{
+		{name: "regional deployment", offered: true},
+		{name: "regional deployment without zones", offered: true, zones: nil},
+		{name: "zone offered", zone: "1", zones: []string{"1", "2", "3"}, offered: true},
+		{
+			name: "location restriction", offered: true, zones: []string{"1", "2", "3"},
+			restrictions: []models.ResourceSkuRestriction{locationRestriction},
+			wantCode:     "NotAvailableForSubscription",
+			wantReason:   "Standard_D8s_v5 is restricted in westeurope for subscription sub (NotAvailableForSubscription)",
+		},
+		{
+			name: "location restriction wins over a zone restriction", zone: "2", zones: []string{"1", "2", "3"}, offered: true,
+			restrictions: []models.ResourceSkuRestriction{zoneRestriction, {Type: "Location", ReasonCode: "QuotaId"}},
+			wantCode:     "QuotaId",
+		},
+		{
+			name:         "location restriction on a SKU that is not listed",
+			restrictions: []models.ResourceSkuRestriction{locationRestriction},
+			wantCode:     "NotAvailableForSubscription",
+		},
+		{
+			name:       "not offered",
+			wantCode:   ReasonNotOfferedInLocation,
+			wantReason: "Standard_D8s_v5 is not offered in westeurope",
+		},
+		{
+			name: "not offered in any zone", zone: "1", offered: true,
+			wantCode:   ReasonNoZones,
+			wantReason: "Standard_D8s_v5 has no availability zones in westeurope",
+		},
+		{
+			name: "not offered in the zone", zone: "3", zones: []string{"1", "2"}, offered: true,
+			wantCode:   ReasonNotOfferedInZone,
+			wantReason: "Standard_D8s_v5 is not offered in westeurope zone 3, only in zones 1, 2",
+		},
+		{
+			name: "zone restriction", zone: "3", zones: []string{"1", "2", "3"}, offered: true,
+			restrictions: []models.ResourceSkuRestriction{zoneRestriction},
+			wantCode:     "NotAvailableForSubscription",
+			wantReason:   "Standard_D8s_v5 is restricted in westeurope zone 3 for subscription sub (NotAvailableForSubscription)",
+		},
+		{
+			name: "zone restriction of other zones", zone: "1", zones: []string{"1", "2", "3"}, offered: true,
+			restrictions: []models.ResourceSkuRestriction{zoneRestriction},
+		},
+		{
+			name: "zone restriction of a regional deployment", zones: []string{"1", "2", "3"}, offered: true,
+			restrictions: []models.ResourceSkuRestriction{zoneRestriction},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := SkuAvailability{Name: "Standard_D8s_v5", SubscriptionID: "sub", Location: "westeurope", Zone: tt.zone, Zones: tt.zones}
+			explainAvailability(&a, tt.offered, tt.restrictions)
+
+			if a.Available != (tt.wantCode == "") || a.ReasonCode != tt.wantCode {
+				t.Errorf("got available %v with %q, want %q", a.Available, a.ReasonCode, tt.wantCode)
+			}
+			if tt.wantReason != "" && a.Reason != tt.wantReason {
+				t.Errorf("got reason %q, want %q", a.Reason, tt.wantReason)
+			}
+			if a.Available && a.Reason != "" {
+				t.Errorf("available with reason %q", a.Reason)
+			}
+			if !a.Available && !strings.HasPrefix(a.Reason, a.Name) {
+				t.Errorf("reason %q does not name the SKU", a.Reason)
+			}
+		})
+	}
+}
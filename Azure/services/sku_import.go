@@ -1,205 +1,233 @@
 package services
 
 import (
-	"github.com/joho/godotenv"
 	"cco_backend/config"
 	"cco_backend/models"
+	"cco_backend/resourceskus"
+	"cco_backend/retailprices"
 	"cco_backend/utils"
+	"context"
 	"fmt"
 	"log"
-	"strconv"
+	"strings"
 	"time"
-	"os"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func ImportSkuData() error {
-	err := godotenv.Load()
-	if err != nil {
-		return fmt.Errorf("error loading .env file: %w", err)
+func ImportSkuData(ctx context.Context) error {
+	if err := RunPipeline(ctx, SkuImport); err != nil {
+		return err
 	}
 
-	// Get the subscription ID from the environment variable
-	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
-	if subscriptionID == "" {
-		return fmt.Errorf("subscription ID not found in environment variables")
-	}
+	log.Println("SKU data import completed successfully.")
+	return nil
+}
 
-	// Price API URL
-	priceApiUrl := "https://prices.azure.com/api/retail/prices?api-version=2023-01-01-preview&$filter=serviceName%20eq%20%27Virtual%20Machines%27"
+// skuSink matches price items against the Resource SKUs API and upserts a Sku row for
+// every match
+type skuSink struct {
+	skuIndex *resourceskus.Index // virtual machine SKUs of the Resource SKUs list by name and location
+	catalog  map[string]uint     // ResourceSku IDs of the virtual machine SKUs by name
+	regions  *regionCache        // region IDs of the run's cloud by region code
+	cloud    string              // cloud of the run, whose unseen SKUs Finish disables
+	currency string              // SKUs do not depend on currency, pages in this one write them
+}
 
-	// SKU API URL (Bearer token is required to access this API)
-	skuApiUrl := fmt.Sprintf(
-		"https://management.azure.com/subscriptions/%s/providers/Microsoft.Compute/skus?api-version=2024-07-01",
-		subscriptionID,
-	)
+func (s *skuSink) Name() string        { return SkuImport }
+func (s *skuSink) DependsOn() []string { return []string{RegionImport} }
 
-	// Fetch bearer token
-	bearerToken, err := utils.GenerateBearerToken()
+// Prepare imports the Resource SKUs list the price items are matched against
+func (s *skuSink) Prepare(ctx context.Context) error {
+	cloud, err := utils.CurrentCloud()
 	if err != nil {
-		return fmt.Errorf("error generating bearer token: %w", err)
+		return err
 	}
 
-	// Fetch SKU data
-	skuData, err := utils.FetchDataWithBearerToken(skuApiUrl, bearerToken)
+	skus, err := ImportResourceSkus(ctx)
 	if err != nil {
-		return fmt.Errorf("error fetching SKU data: %w", err)
+		return err
 	}
+	vmSkus := make([]resourceskus.ResourceSku, 0, len(skus))
+	for _, sku := range skus {
+		if sku.ResourceType == "virtualMachines" {
+			vmSkus = append(vmSkus, sku)
+		}
+	}
+	s.skuIndex = resourceskus.NewIndex(vmSkus)
 
-	skuItems, ok := skuData["value"].([]interface{}) // Extract the value from SKU data
-	if !ok {
-		return fmt.Errorf("invalid format for SKU items")
+	var rows []models.ResourceSku
+	if err := config.DB.WithContext(ctx).Where("resource_type = ?", "virtualMachines").Find(&rows).Error; err != nil {
+		return fmt.Errorf("error loading resource SKUs: %w", err)
+	}
+	s.catalog = make(map[string]uint, len(rows))
+	for _, row := range rows {
+		s.catalog[row.Name] = row.ResourceSkuID
 	}
 
-	// Pagination loop for price data
-	nextPageUrl := priceApiUrl
-	pageCount := 0
-	batchSize := 10 // Number of pages to process in each batch
+	s.regions = newRegionCache(cloud.Name)
+	s.cloud = cloud.Name
+	s.currency = config.LoadPriceImportConfig().PrimaryCurrency()
+	return nil
+}
 
-	for nextPageUrl != "" {
-		// Fetch price data for the current page
-		priceData, err := utils.FetchData(nextPageUrl)
-		if err != nil {
-			return fmt.Errorf("error fetching price data: %w", err)
+func (s *skuSink) Consume(tx *gorm.DB, page *retailprices.PricesPage) error {
+	rows := make([]models.Sku, 0, len(page.Items))
+	index := map[skuKey]int{}
+	now := time.Now()
+	for _, priceItem := range page.Items {
+		// Extract required fields from price API
+		skuCode := priceItem.SkuID
+		productName := priceItem.ProductName
+		productFamily := priceItem.ServiceFamily
+		armSkuName := priceItem.ArmSkuName
+		if armSkuName == "" {
+			log.Printf("Missing armSkuName for skuId: %s", skuCode)
+			continue
 		}
+		usageType := priceItem.Type
+		regionName := priceItem.ArmRegionName
 
-		// Parse price items
-		priceItems, ok := priceData["Items"].([]interface{})
+		// Match with SKU API data
+		matchedSku, ok := s.skuIndex.Lookup(armSkuName, regionName)
 		if !ok {
-			return fmt.Errorf("invalid format for price items")
+			log.Printf("No matching SKU found for armSkuName: %s", armSkuName)
+			continue
 		}
 
-		for _, priceItemInterface := range priceItems {
-			priceItem, ok := priceItemInterface.(map[string]interface{})
-			if !ok {
-				log.Printf("Skipping invalid price item: %v", priceItemInterface)
-				continue
-			}
-
-			// Extract required fields safely from price API
-			skuCode, _ := safeString(priceItem["skuId"])
-			productName, _ := safeString(priceItem["productName"])
-			productFamily, _ := safeString(priceItem["serviceFamily"])
-			armSkuName, ok := safeString(priceItem["armSkuName"])
-			if !ok {
-				log.Printf("Missing or invalid armSkuName: %v", priceItem)
-				continue
-			}
-			usageType, ok := safeString(priceItem["type"])
-			if !ok {
-				log.Printf("Missing or invalid type: %v", priceItem)
-				continue
-			}
-			regionName, _ := safeString(priceItem["armRegionName"])
-
-			// Match with SKU API data
-			var matchedSku map[string]interface{}
-			for _, skuItemInterface := range skuItems {
-				skuItem, ok := skuItemInterface.(map[string]interface{})
-				if !ok {
-					continue
-				}
-				name, _ := safeString(skuItem["name"])
-				if name == armSkuName {
-					matchedSku = skuItem
-					break
-				}
-			}
-
-			if matchedSku == nil {
-				log.Printf("No matching SKU found for armSkuName: %s", armSkuName)
-				continue
-			}
-
-			// Extract details from matched SKU
-			name, _ := safeString(matchedSku["name"])
-
-			// Initialize variables
-			var vCPU int
-			var memory, cpuArchitectureType, network string
-
-			capabilities, ok := matchedSku["capabilities"].([]interface{})
-			if ok {
-				for _, capabilityInterface := range capabilities {
-					capability, ok := capabilityInterface.(map[string]interface{})
-					if !ok {
-						continue
-					}
-					switch capName, _ := safeString(capability["name"]); capName {
-					case "vCPUs":
-						vCPU = atoi(capability["value"].(string))
-					case "MemoryGB":
-						memory, _ = safeString(capability["value"])
-					case "CpuArchitectureType":
-						cpuArchitectureType, _ = safeString(capability["value"])
-					case "MaxNetworkInterfaces":
-						network, _ = safeString(capability["value"])
-					}
-				}
-			}
-
-			// Fetch service and region IDs
-			region := models.Region{}
-
-			if err := config.DB.Where("region_name = ?", regionName).First(&region).Error; err != nil {
-				log.Printf("Error finding region: %v", err)
-				continue
-			}
-
-			// Insert SKU into the database
-			sku := models.Sku{
-				RegionID:             region.RegionID,
-				Armskuname:           armSkuName,
-				Name:                 name,
-				UsageType:            usageType, // Renamed "type" to "usage_type"
-				SkuCode:              &skuCode, // Renamed "sku_id_api" to "sku_code"
-				ProductName:          &productName,
-				ProductFamily:        &productFamily, // Renamed "service_family" to "product_family"
-				VCPU:                 vCPU,         // Renamed "vcpus" to "v_cpu"
-				Memory:               memory,       // Renamed "memorygb" to "memory"
-				CpuArchitectureType:  cpuArchitectureType,
-				Network:              network, // Renamed "maxnetworkinterfaces" to "network"
-			}
-
-			result := config.DB.Create(&sku)
-			if result.Error != nil {
-				log.Printf("Error inserting SKU: %v", result.Error)
-			} else {
-				log.Printf("SKU inserted successfully: %v", sku.Name)
-			}
+		// Extract details from matched SKU
+		name := matchedSku.Name
+
+		// The common capabilities are kept on the row, every capability is in sku_capabilities
+		capabilities := resourceskus.NewCapabilities(matchedSku.Capabilities)
+
+		// Fetch region ID, regions are written by the region sink
+		regionID, ok, err := s.regions.lookup(tx, regionName)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Printf("Region %s not found, skipping SKU %s", regionName, armSkuName)
+			continue
 		}
 
-		// Increment page counter
-		pageCount++
-		if pageCount >= batchSize {
-			log.Printf("Processed %d pages in this batch. Fetching next batch...", batchSize)
+		// SKU row, written together with the rest of the page below
+		sku := models.Sku{
+			RegionID:             regionID,
+			Armskuname:           armSkuName,
+			Name:                 name,
+			UsageType:            usageType, // Renamed "type" to "usage_type"
+			SkuCode:              &skuCode,  // Renamed "sku_id_api" to "sku_code"
+			ProductName:          &productName,
+			ProductFamily:        &productFamily, // Renamed "service_family" to "product_family"
+			VCPU:                 capabilities.VCPUs(),
+			MemoryGB:             capabilities.MemoryGB(),
+			CpuArchitectureType:  capabilities.CpuArchitecture(),
+			MaxNetworkInterfaces: capabilities.MaxNetworkInterfaces(),
+			LastSeenAt:           &now,
+		}
+		if id, ok := s.catalog[name]; ok {
+			sku.ResourceSkuID = &id
+		}
+		if sizeName, err := resourceskus.ParseSkuName(armSkuName); err == nil {
+			sku.SizeSeries = sizeName.Series()
+			sku.SizeFamily = sizeName.Family
+			sku.SizeVCPUs = sizeName.Size
+			sku.SizeFeatures = sizeName.Features
+			sku.SizeAccelerator = sizeName.Accelerator
+			sku.SizeSuffix = sizeName.Suffix
+			sku.SizeVersion = sizeName.Version
+		} else {
+			log.Printf("Cannot parse armSkuName %s: %v", armSkuName, err)
+		}
 
-			// Reset the page count for the next batch
-			pageCount = 0
+		// A statement may not update the same row twice, so later duplicates win
+		key := skuKey{skuCode, regionID, usageType}
+		if existing, ok := index[key]; ok {
+			rows[existing] = sku
+			continue
+		}
+		index[key] = len(rows)
+		rows = append(rows, sku)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
 
-			// Optional pause between batches
-			time.Sleep(2 * time.Second)
+	// SKU rows are filled from the primary currency, whose shards are crawled first.
+	// Pages of other currencies only add the rows that are still missing, so that none of
+	// their prices is dropped for lack of a SKU, without overwriting the primary ones.
+	if len(page.Items) > 0 && page.Items[0].CurrencyCode != s.currency {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sku_id_api"}, {Name: "region_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_seen_at", "disable_flag"}),
+		}).CreateInBatches(&rows, upsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("error inserting SKUs: %w", err)
 		}
+		return nil
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "sku_id_api"}, {Name: "region_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"armskuname", "name", "product_name", "service_family", "v_cpus", "memory_gb",
+			"cpu_architecture_type", "max_network_interfaces", "resource_sku_id", "size_series",
+			"size_family", "size_vcpus", "size_features", "size_accelerator", "size_suffix",
+			"size_version", "last_seen_at", "disable_flag", "modified_at",
+		}),
+	}).CreateInBatches(&rows, upsertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("error upserting SKUs: %w", err)
+	}
+	log.Printf("Upserted %d SKUs", len(rows))
+	return nil
+}
 
-		// Check for the next page
-		nextPageUrl, _ = safeString(priceData["NextPageLink"])
-		log.Printf("Next page URL: %s", nextPageUrl)
+// Finish disables the SKUs of the crawled regions and price types that the completed
+// crawl no longer listed, so they show up as retired in catalog reports. A crawl that
+// skipped virtual machines or was narrowed by date or a raw filter does not see every
+// SKU, so nothing is disabled then.
+func (s *skuSink) Finish(ctx context.Context, crawlStart time.Time) error {
+	scope := config.LoadPriceImportConfig()
+	if !coversVMCatalog(scope) {
+		log.Printf("Import scope does not cover every SKU, not disabling unseen SKUs")
+		return nil
 	}
 
-	log.Println("SKU data import completed successfully.")
+	regions := config.DB.Model(&models.Region{}).Select("region_id").Where("cloud = ?", s.cloud)
+	if len(scope.Regions) > 0 {
+		regions = regions.Where("region_code IN ?", scope.Regions)
+	}
+	query := config.DB.WithContext(ctx).Model(&models.Sku{}).
+		Where("region_id IN (?)", regions).
+		Where("disable_flag IS NOT TRUE AND (last_seen_at IS NULL OR last_seen_at < ?)", crawlStart)
+	if len(scope.PriceTypes) > 0 {
+		query = query.Where(`"type" IN ?`, scope.PriceTypes)
+	}
+	result := query.Updates(map[string]interface{}{"disable_flag": true, "modified_at": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("error disabling unseen SKUs: %w", result.Error)
+	}
+	log.Printf("Disabled %d SKUs no longer listed in %s", result.RowsAffected, s.cloud)
 	return nil
 }
 
-// Helper function to safely retrieve a string value from an interface{}
-func safeString(value interface{}) (string, bool) {
-	str, ok := value.(string)
-	return str, ok
+// coversVMCatalog reports whether scope crawls every VM price of the regions it covers,
+// so rows of those regions that the crawl did not list are gone from the catalog.
+// Narrowing the services, the effective dates or adding a raw filter leaves rows out.
+func coversVMCatalog(scope config.PriceImportConfig) bool {
+	return containsFold(scope.Services, retailprices.ServiceVirtualMachines) && scope.ExtraFilter == "" &&
+		scope.EffectiveFrom.IsZero() && scope.EffectiveTo.IsZero()
 }
 
-// Helper function to convert string to integer
-func atoi(str string) int {
-	val, err := strconv.Atoi(str)
-	if err != nil {
-		return 0
+// containsFold reports whether list holds value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, value) {
+			return true
+		}
 	}
-	return val
+	return false
 }
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"cco_backend/config"
+	"testing"
+	"time"
+)
+
+func TestCoversVMCatalog(t *testing.T) {
+	vms := []string{"Virtual Machines"}
+	tests := []struct {
+		name  string
+		scope config.PriceImportConfig
+		want  bool
+	}{
+		{"default", config.PriceImportConfig{Services: vms}, true},
+		{"region list", config.PriceImportConfig{Services: vms, Regions: []string{"eastus"}}, true},
+		{"VMs among other services", config.PriceImportConfig{Services: []string{"Storage", "virtual machines"}}, true},
+		{"other services only", config.PriceImportConfig{Services: []string{"Storage"}}, false},
+		{"raw filter", config.PriceImportConfig{Services: vms, ExtraFilter: "productName eq 'Virtual Machines Dv5 Series'"}, false},
+		{"effective from", config.PriceImportConfig{Services: vms, EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, false},
+		{"effective to", config.PriceImportConfig{Services: vms, EffectiveTo: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coversVMCatalog(tt.scope); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"cco_backend/resourceskus"
+	"context"
+	"fmt"
+)
+
+// FindSkuCapabilities returns every capability of a Resource SKUs catalog entry. Use the
+// typed accessors (VCPUs, MemoryGB, GPUs, PremiumIO, ...) for the common ones.
+func FindSkuCapabilities(ctx context.Context, resourceSkuID uint) (resourceskus.Capabilities, error) {
+	var rows []models.SkuCapability
+	if err := config.DB.WithContext(ctx).Where("resource_sku_id = ?", resourceSkuID).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error loading capabilities of resource SKU %d: %w", resourceSkuID, err)
+	}
+
+	capabilities := make(resourceskus.Capabilities, len(rows))
+	for _, row := range rows {
+		capabilities[row.Name] = row.Value
+	}
+	return capabilities, nil
+}
+
+// FindSkuCapabilitiesByName returns the capabilities of a virtual machine size, e.g.
+// Standard_D8s_v5
+func FindSkuCapabilitiesByName(ctx context.Context, name string) (resourceskus.Capabilities, error) {
+	var sku models.ResourceSku
+	err := config.DB.WithContext(ctx).
+		Where("resource_type = ? AND name = ?", "virtualMachines", name).
+		First(&sku).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading resource SKU %s: %w", name, err)
+	}
+	return FindSkuCapabilities(ctx, sku.ResourceSkuID)
+}
+
+// FindNextSkuSize returns the next larger VM size of the same series as armSkuName
+// (e.g. Standard_D8ads_v5 for Standard_D4ads_v5) imported for a region, or the next
+// smaller one when down is set. ok is false when armSkuName is already the largest or
+// smallest size there.
+func FindNextSkuSize(ctx context.Context, armSkuName, regionCode string, down bool) (next string, ok bool, err error) {
+	current, err := resourceskus.ParseSkuName(armSkuName)
+	if err != nil {
+		return "", false, err
+	}
+
+	var names []string
+	err = config.DB.WithContext(ctx).Model(&models.Sku{}).
+		Joins("JOIN regions ON regions.region_id = skus.region_id").
+		Where("skus.size_series = ? AND regions.region_code = ?", current.Series(), regionCode).
+		Distinct().
+		Pluck("skus.armskuname", &names).Error
+	if err != nil {
+		return "", false, fmt.Errorf("error loading sizes of %s in %s: %w", current.Series(), regionCode, err)
+	}
+
+	candidates := make([]resourceskus.SkuName, 0, len(names))
+	for _, name := range names {
+		if candidate, err := resourceskus.ParseSkuName(name); err == nil {
+			candidates = append(candidates, candidate)
+		}
+	}
+	size, ok := resourceskus.NextSize(current, candidates, down)
+	if !ok {
+		return "", false, nil
+	}
+	return size.String(), true, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"cco_backend/config"
+	"cco_backend/models"
+	"cco_backend/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// subscriptionsAPIVersion is the ARM api-version used to list subscriptions
+const subscriptionsAPIVersion = "2022-12-01"
+
+// armSubscription is an entry of the ARM subscriptions list
+type armSubscription struct {
+	SubscriptionID string `json:"subscriptionId"`
+	DisplayName    string `json:"displayName"`
+	State          string `json:"state"`
+}
+
+// discoverSubscriptions lists the enabled subscriptions the credentials can see,
+// following nextLink
+func discoverSubscriptions(ctx context.Context, cloud utils.Cloud) ([]armSubscription, error) {
+	var subscriptions []armSubscription
+	next := fmt.Sprintf("%s/subscriptions?api-version=%s", cloud.ResourceManagerEndpoint, subscriptionsAPIVersion)
+	for next != "" {
+		body, err := utils.FetchBodyWithBearerToken(ctx, next, utils.DefaultTokenProvider(), cloud.TokenScope)
+		if err != nil {
+			return nil, fmt.Errorf("error listing subscriptions: %w", err)
+		}
+
+		var page struct {
+			Value    []armSubscription `json:"value"`
+			NextLink string            `json:"nextLink"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("error decoding subscriptions list: %w", err)
+		}
+		for _, subscription := range page.Value {
+			// Disabled and deleted subscriptions cannot list SKUs
+			if subscription.State == "Enabled" || subscription.State == "Warned" || subscription.State == "PastDue" {
+				subscriptions = append(subscriptions, subscription)
+			} else {
+				log.Printf("Skipping subscription %s (%s)", subscription.SubscriptionID, subscription.State)
+			}
+		}
+		next = page.NextLink
+	}
+	return subscriptions, nil
+}
+
+// skuSubscriptions returns the configured subscriptions, together with the discovered
+// ones when discovery is enabled, without duplicates
+func skuSubscriptions(ctx context.Context, cfg config.SkuImportConfig, cloud utils.Cloud) ([]armSubscription, error) {
+	subscriptions := make([]armSubscription, 0, len(cfg.SubscriptionIDs))
+	seen := map[string]bool{}
+	for _, id := range cfg.SubscriptionIDs {
+		if !seen[id] {
+			seen[id] = true
+			subscriptions = append(subscriptions, armSubscription{SubscriptionID: id})
+		}
+	}
+
+	if cfg.Discover {
+		discovered, err := discoverSubscriptions(ctx, cloud)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range discovered {
+			if !seen[subscription.SubscriptionID] {
+				seen[subscription.SubscriptionID] = true
+				subscriptions = append(subscriptions, subscription)
+			}
+		}
+		log.Printf("Discovered %d subscriptions", len(discovered))
+	}
+
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("no subscriptions to import SKUs for")
+	}
+	return subscriptions, nil
+}
+
+// markSubscriptionImported records a subscription and when its SKUs were last imported
+func markSubscriptionImported(ctx context.Context, subscription armSubscription, cloud string) error {
+	now := time.Now()
+	row := models.Subscription{
+		SubscriptionID: subscription.SubscriptionID,
+		DisplayName:    subscription.DisplayName,
+		State:          subscription.State,
+		Cloud:          cloud,
+		SkusImportedAt: &now,
+		ModifiedDate:   now,
+	}
+
+	updates := []string{"cloud", "skus_imported_at", "modified_date"}
+	if subscription.State != "" {
+		// Configured subscriptions come without name and state, keep the discovered ones
+		updates = append(updates, "display_name", "state")
+	}
+	err := config.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("error saving subscription %s: %w", subscription.SubscriptionID, err)
+	}
+	return nil
+}
@@ -3,121 +3,264 @@ package services
 import (
 	"cco_backend/config"
 	"cco_backend/models"
+	"cco_backend/retailprices"
 	"cco_backend/utils"
+	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func ImportTermsData() error {
-	// Prices API base URL
-	basePriceApiUrl := "https://prices.azure.com/api/retail/prices?api-version=2023-01-01-preview&$filter=serviceName%20eq%20%27Virtual%20Machines%27"
+func ImportTermsData(ctx context.Context) error {
+	if err := RunPipeline(ctx, TermImport); err != nil {
+		return err
+	}
 
-	nextPageUrl := basePriceApiUrl
-	totalPagesFetched := 0 //keeps track of how many pages have been fetched from api
+	log.Println("Terms data import completed successfully.")
+	return nil
+}
 
-	for nextPageUrl != "" { //for pagination
-		// Fetch pricing data for the current page
-		priceData, err := utils.FetchData(nextPageUrl) //calls fetch data function to fetch data
-		if err != nil {
-			return fmt.Errorf("error fetching price data: %w", err)
-		}
+// Purchase options of the terms
+const (
+	termSavingsPlan = "SavingsPlan"
+	termReservation = "Reservation"
+)
+
+// hoursPerYear is the number of hours a reservation year is billed for
+const hoursPerYear = 8760
+
+// termSink upserts a Term row with its hourly rate for every savings plan attached to a
+// price item, and for every reservation price item
+type termSink struct {
+	regions *regionCache // region IDs of the run's cloud by region code
+}
+
+func (s *termSink) Name() string        { return TermImport }
+func (s *termSink) DependsOn() []string { return []string{PriceImport} }
+
+func (s *termSink) Prepare(ctx context.Context) error {
+	cloud, err := utils.CurrentCloud()
+	if err != nil {
+		return err
+	}
+	s.regions = newRegionCache(cloud.Name)
+	return nil
+}
 
-		// Parse data
-		priceItems, ok := priceData["Items"].([]interface{})
-		if !ok {
-			return fmt.Errorf("invalid format for price items")
+func (s *termSink) Consume(tx *gorm.DB, page *retailprices.PricesPage) error {
+	// Only items with a savings plan and reservation items carry terms
+	var items []retailprices.PriceItem
+	for _, item := range page.Items {
+		if len(item.SavingsPlan) > 0 || isReservationItem(item) {
+			items = append(items, item)
 		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
 
-		// Process each price item
-		for _, priceItemInterface := range priceItems {
-			priceItem, ok := priceItemInterface.(map[string]interface{})
-			if !ok {
-				log.Printf("Skipping invalid price item: %v", priceItemInterface)
-				continue
-			}
+	// The price rows the terms belong to, written by the price sink earlier in the same
+	// page's transaction or by an earlier run
+	prices, err := findPrices(tx, s.regions, items)
+	if err != nil {
+		return err
+	}
 
-			// Extract required fields from the price API
-			skuID, _ := priceItem["skuId"].(string)
+	savingsPlans, reservations := termsOf(items, prices, time.Now())
 
-			// Find the corresponding SKU in the database
-			sku := models.Sku{}
-			if err := config.DB.Where("sku_id = ?", skuID).First(&sku).Error; err != nil {
-				log.Printf("SKU not found for skuId: %s, skipping...", skuID)
-				continue
-			}
+	// The on-demand price of a reservation is only known once every shard was written,
+	// see Finish, so an upsert must not reset it
+	if err := upsertTerms(tx, savingsPlans.terms, "sku_id", "discounted_rate", "unit_price", "on_demand_price_id", "discount_percent", "modified_date"); err != nil {
+		return err
+	}
+	if err := upsertTerms(tx, reservations.terms, "sku_id", "discounted_rate", "modified_date"); err != nil {
+		return err
+	}
+	if len(savingsPlans.terms)+len(reservations.terms) > 0 {
+		log.Printf("Upserted %d savings plan and %d reservation terms", len(savingsPlans.terms), len(reservations.terms))
+	}
+	return nil
+}
+
+// termsOf builds the savings plan and reservation terms of items, whose price rows are
+// at the same index of prices (nil when not found)
+func termsOf(items []retailprices.PriceItem, prices []*models.Price, now time.Time) (savingsPlans, reservations termBatch) {
+	for i, item := range items {
+		price := prices[i]
+		if price == nil {
+			log.Printf("Price not found for skuId: %s, meterId: %s, skipping its terms...", item.SkuID, item.MeterID)
+			continue
+		}
 
-			// Find or create the corresponding price record
-			priceRecord := models.Price{}
-			priceID := 0 // Initialize as 0, will be updated if price exists
-			// You can adjust the condition based on what data you have available
-			if err := config.DB.Where("sku_id = ?", skuID).First(&priceRecord).Error; err != nil {
-				// Insert the price record if it doesn't exist
-				priceRecord = models.Price{
-					SkuID: int(sku.ID), // Ensure this matches your foreign key type
-					// Add any other necessary fields for the priceRecord
-				}
-				if err := config.DB.Create(&priceRecord).Error; err != nil {
-					log.Printf("Error creating price record for skuId: %s, error: %v", skuID, err)
-					continue
-				}
-				priceID = priceRecord.PriceID
-				log.Printf("Created new price record for skuId: %s", skuID)
-			} else {
-				priceID = priceRecord.PriceID
+		// One term per savings plan length, priced per hour like the item it is attached to
+		for _, plan := range item.SavingsPlan {
+			leaseContractLength := plan.Term
+			purchaseOption := termSavingsPlan
+			rate, unitPrice := plan.RetailPrice, plan.UnitPrice
+			onDemandPriceID := uint(price.PriceID)
+			term := models.Term{
+				PriceID:             uint(price.PriceID),
+				SkuID:               price.SkuID,
+				PurchaseOption:      &purchaseOption,
+				LeaseContractLength: &leaseContractLength,
+				DiscountedRate:      &rate,
+				UnitPrice:           &unitPrice,
+				OnDemandPriceID:     &onDemandPriceID,
+				DiscountPercent:     discountPercent(rate, price.RetailPrice),
+				CreatedDate:         now,
+				ModifiedDate:        now,
 			}
+			savingsPlans.add(term)
+		}
 
-			// Extract savingsPlan from the price API
-			savingsPlans, ok := priceItem["savingsPlan"].([]interface{})
+		// A reservation price is the upfront total of the whole term
+		if isReservationItem(item) {
+			hours, ok := reservationHours(item.ReservationTerm)
 			if !ok {
-				log.Printf("No savings plan available for skuId: %s, skipping...", skuID)
+				log.Printf("Unknown reservation term %q for skuId: %s, skipping...", item.ReservationTerm, item.SkuID)
 				continue
 			}
-
-			// Process each savings plan
-			for _, planInterface := range savingsPlans {
-				plan, ok := planInterface.(map[string]interface{})
-				if !ok {
-					log.Printf("Skipping invalid savings plan for skuId: %s", skuID)
-					continue
-				}
-
-				leaseContractLength, _ := plan["term"].(string)
-
-				// Create a new Term entry
-				term := models.Term{
-					PriceID:             uint(priceID), // Convert int to uint
-					SkuID:               int(sku.ID),  // Convert int to uint
-					OfferTermCode:       nil,            // Set to NULL
-					PurchaseOption:      nil,            // Null as specified
-					OfferingClass:       nil,            // Null as specified
-					LeaseContractLength: &leaseContractLength, // Nullable field
-					CreatedDate:         time.Now(),     // Automatically generated
-					ModifiedDate:        time.Now(),     // Automatically generated
-					DisableFlag:         false,          // Default value
-				}
-
-				// Insert the Term into the database
-				result := config.DB.Create(&term)
-				if result.Error != nil {
-					log.Printf("Error inserting term for skuId: %s, error: %v", skuID, result.Error)
-				} else {
-					log.Printf("Term inserted successfully for skuId: %s with lease_contract_length: %s", skuID, leaseContractLength)
-				}
+			leaseContractLength := item.ReservationTerm
+			purchaseOption := termReservation
+			hourlyRate := item.RetailPrice / hours
+			term := models.Term{
+				PriceID:             uint(price.PriceID),
+				SkuID:               price.SkuID,
+				PurchaseOption:      &purchaseOption,
+				LeaseContractLength: &leaseContractLength,
+				DiscountedRate:      &hourlyRate,
+				CreatedDate:         now,
+				ModifiedDate:        now,
 			}
+			reservations.add(term)
 		}
+	}
+	return savingsPlans, reservations
+}
 
-		// Increment total pages fetched
-		totalPagesFetched++
+// termBatch collects the terms of one upsert statement. A statement may not update the
+// same row twice, so a later term with the same key replaces the earlier one.
+type termBatch struct {
+	index map[termKey]int
+	terms []models.Term
+}
 
-		// Get the next page URL
-		nextPageUrl, _ = priceData["NextPageLink"].(string)
-		log.Printf("Next page URL: %s", nextPageUrl)
+// termKey is the natural key of a Term row
+type termKey struct {
+	priceID        uint
+	purchaseOption string
+	length         string
+}
 
-		// Optional delay between requests to avoid rate limiting
-		time.Sleep(2 * time.Second)
+func (b *termBatch) add(term models.Term) {
+	if b.index == nil {
+		b.index = map[termKey]int{}
+	}
+	key := termKey{term.PriceID, *term.PurchaseOption, *term.LeaseContractLength}
+	if existing, ok := b.index[key]; ok {
+		b.terms[existing] = term
+		return
 	}
+	b.index[key] = len(b.terms)
+	b.terms = append(b.terms, term)
+}
 
-	log.Println("Terms data import completed successfully.")
+// upsertTerms writes terms, updating columns of the rows that already exist
+func upsertTerms(tx *gorm.DB, terms []models.Term, columns ...string) error {
+	if len(terms) == 0 {
+		return nil
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "price_id"}, {Name: "purchase_option"}, {Name: "lease_contract_length"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).CreateInBatches(&terms, upsertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("error upserting terms: %w", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// discountPercent returns the saving of rate against the on-demand price, nil when the
+// on-demand price is zero
+func discountPercent(rate, onDemand float64) *float64 {
+	if onDemand <= 0 {
+		return nil
+	}
+	percent := (1 - rate/onDemand) * 100
+	return &percent
+}
+
+// Finish links the reservation terms to their on-demand prices. Reservation and
+// consumption prices are crawled in different shards, so this waits for both.
+func (s *termSink) Finish(ctx context.Context, crawlStart time.Time) error {
+	return LinkReservationTerms(ctx)
+}
+
+// LinkReservationTerms sets the on-demand price and discount percent of every
+// reservation term. The on-demand price is the consumption price of the same VM size,
+// region and currency for Linux, without spot or low priority, since a reservation only
+// covers compute. The one in effect when the reservation price started is used, or the
+// earliest one after it when there is none.
+func LinkReservationTerms(ctx context.Context) error {
+	result := config.DB.WithContext(ctx).Exec(`
+		UPDATE terms t
+		SET on_demand_price_id = x.on_demand_price_id,
+			discount_percent = x.discount_percent,
+			modified_date = ?
+		FROM (
+			SELECT rt.offer_term_id, od.price_id AS on_demand_price_id,
+				CASE WHEN od.retail_price > 0 THEN ROUND((1 - rt.discounted_rate / od.retail_price) * 100, 4) END AS discount_percent
+			FROM terms rt
+			JOIN prices rp ON rp.price_id = rt.price_id
+			JOIN skus rs ON rs.id = rp.sku_id
+			CROSS JOIN LATERAL (
+				SELECT p.price_id, p.retail_price
+				FROM prices p
+				JOIN skus s ON s.id = p.sku_id
+				WHERE s.region_id = rs.region_id
+					AND s.armskuname = rs.armskuname
+					AND s.type = ?
+					AND p.currency_code = rp.currency_code
+					AND p.tier_minimum_units = 0
+					AND p.operating_system = ?
+					AND p.priority = ?
+				ORDER BY p.effective_date > rp.effective_date,
+					CASE WHEN p.effective_date <= rp.effective_date THEN p.effective_date END DESC,
+					p.effective_date
+				LIMIT 1
+			) od
+			WHERE rt.purchase_option = ?
+		) x
+		WHERE t.offer_term_id = x.offer_term_id
+			AND (t.on_demand_price_id IS DISTINCT FROM x.on_demand_price_id
+				OR t.discount_percent IS DISTINCT FROM x.discount_percent)`,
+		time.Now(), retailprices.PriceTypeConsumption, retailprices.OSLinux, retailprices.PriorityRegular, termReservation)
+	if result.Error != nil {
+		return fmt.Errorf("error linking reservation terms to on-demand prices: %w", result.Error)
+	}
+	log.Printf("Linked %d reservation terms to on-demand prices", result.RowsAffected)
+	return nil
+}
+
+// isReservationItem reports whether an item is the price of a reservation term
+func isReservationItem(item retailprices.PriceItem) bool {
+	return item.Type == retailprices.PriceTypeReservation && item.ReservationTerm != ""
+}
+
+// reservationHours returns the hours of a reservation term such as "1 Year" or "3 Years"
+func reservationHours(term string) (float64, bool) {
+	fields := strings.Fields(term)
+	if len(fields) != 2 || !strings.HasPrefix(strings.ToLower(fields[1]), "year") {
+		return 0, false
+	}
+	years, err := strconv.Atoi(fields[0])
+	if err != nil || years <= 0 {
+		return 0, false
+	}
+	return float64(years * hoursPerYear), true
+}
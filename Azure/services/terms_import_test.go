@@ -0,0 +1,235 @@
+package services
+
+import (
+	"cco_backend/models"
+	"cco_backend/retailprices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReservationHours(t *testing.T) {
+	tests := []struct {
+		term  string
+		hours float64
+		ok    bool
+	}{
+		{"1 Year", 8760, true},
+		{"3 Years", 3 * 8760, true},
+		{"5 Years", 5 * 8760, true},
+		{" 3  years ", 3 * 8760, true},
+		{"", 0, false},
+		{"1", 0, false},
+		{"One Year", 0, false},
+		{"0 Years", 0, false},
+		{"-1 Year", 0, false},
+		{"36 Months", 0, false},
+		{"1 Year upfront", 0, false},
+	}
+
+	for _, tt := range tests {
+		hours, ok := reservationHours(tt.term)
+		if hours != tt.hours || ok != tt.ok {
+			t.Errorf("reservationHours(%q) = %v, %v, want %v, %v", tt.term, hours, ok, tt.hours, tt.ok)
+		}
+	}
+}
+
+func TestTermsOfReservations(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	reservation := func(term string, total float64) retailprices.PriceItem {
+		return retailprices.PriceItem{SkuID: "DZH318Z0BQPS/00TG", MeterID: "m1", Type: retailprices.PriceTypeReservation, ReservationTerm: term, RetailPrice: total}
+	}
+	items := []retailprices.PriceItem{
+		reservation("1 Year", 8760),
+		reservation("3 Years", 3*8760*0.5),
+		reservation("5 Years", 100),
+		reservation("36 Months", 1000), // unknown term
+		reservation("1 Year", 1000),    // its price row was not found
+	}
+	prices := []*models.Price{
+		{PriceID: 11, SkuID: 7},
+		{PriceID: 12, SkuID: 7},
+		{PriceID: 13, SkuID: 7},
+		{PriceID: 14, SkuID: 7},
+		nil,
+	}
+
+	savingsPlans, reservations := termsOf(items, prices, now)
+	if len(savingsPlans.terms) != 0 {
+		t.Errorf("got %d savings plan terms", len(savingsPlans.terms))
+	}
+	want := []struct {
+		priceID uint
+		length  string
+		rate    float64
+	}{
+		{11, "1 Year", 1},
+		{12, "3 Years", 0.5},
+		{13, "5 Years", 100.0 / (5 * 8760)},
+	}
+	if len(reservations.terms) != len(want) {
+		t.Fatalf("got %d reservation terms, want %d", len(reservations.terms), len(want))
+	}
+	for i, w := range want {
+		term := reservations.terms[i]
+		if term.PriceID != w.priceID || term.SkuID != 7 || *term.PurchaseOption != termReservation || *term.LeaseContractLength != w.length {
+			t.Errorf("term %d: price %d, SKU %d, %s %s", i, term.PriceID, term.SkuID, *term.PurchaseOption, *term.LeaseContractLength)
+		}
+		if diff := *term.DiscountedRate - w.rate; diff > 1e-12 || diff < -1e-12 {
+			t.Errorf("term %d: hourly rate %v, want %v", i, *term.DiscountedRate, w.rate)
+		}
+		// Linked to the on-demand price only once every shard is written
+		if term.OnDemandPriceID != nil || term.DiscountPercent != nil {
+			t.Errorf("term %d: linked to an on-demand price already", i)
+		}
+		if !term.CreatedDate.Equal(now) || !term.ModifiedDate.Equal(now) {
+			t.Errorf("term %d: dated %s and %s", i, term.CreatedDate, term.ModifiedDate)
+		}
+	}
+}
+
+func TestTermsOfKeepsLastDuplicate(t *testing.T) {
+	items := []retailprices.PriceItem{
+		{Type: retailprices.PriceTypeReservation, ReservationTerm: "1 Year", RetailPrice: 8760},
+		{Type: retailprices.PriceTypeReservation, ReservationTerm: "1 Year", RetailPrice: 2 * 8760},
+	}
+	price := &models.Price{PriceID: 11, SkuID: 7}
+
+	_, reservations := termsOf(items, []*models.Price{price, price}, time.Now())
+	if len(reservations.terms) != 1 || *reservations.terms[0].DiscountedRate != 2 {
+		t.Errorf("got %d terms, want the later one only", len(reservations.terms))
+	}
+}
+
+func TestUpsertReservationTerms(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	_, reservations := termsOf(
+		[]retailprices.PriceItem{{Type: retailprices.PriceTypeReservation, ReservationTerm: "3 Years", RetailPrice: 3 * 8760}},
+		[]*models.Price{{PriceID: 11, SkuID: 7}},
+		time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	)
+	if err := upsertTerms(db, reservations.terms, "sku_id", "discounted_rate", "modified_date"); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := recorder.last(t)
+	for _, want := range []string{
+		`INSERT INTO "terms"`,
+		"(NULL,11,7,'Reservation','3 Years',NULL,1,NULL,NULL,NULL,NULL,false,",
+		`ON CONFLICT ("price_id","purchase_option","lease_contract_length") DO UPDATE SET "sku_id"="excluded"."sku_id","discounted_rate"="excluded"."discounted_rate","modified_date"="excluded"."modified_date"`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("statement lacks %q:\n%s", want, sql)
+		}
+	}
+	// The link to the on-demand price is kept on conflict
+	if strings.Contains(sql, `"on_demand_price_id"="excluded"`) {
+		t.Errorf("upsert resets the on-demand price:\n%s", sql)
+	}
+
+	recorder.statements = nil
+	if err := upsertTerms(db, nil, "sku_id"); err != nil || len(recorder.statements) != 0 {
+		t.Errorf("empty upsert: %v, %v", err, recorder.statements)
+	}
+}
+
+func TestDiscountPercent(t *testing.T) {
+	tests := []struct {
+		rate, onDemand float64
+		want           *float64
+	}{
+		{0.75, 1, ptr(25.0)},
+		{1, 1, ptr(0.0)},
+		{0, 0.4, ptr(100.0)},
+		{1.2, 1, ptr(-20.0)}, // a rate above the on-demand price is a negative saving
+		{0.5, 0, nil},
+		{0.5, -1, nil},
+	}
+
+	for _, tt := range tests {
+		got := discountPercent(tt.rate, tt.onDemand)
+		switch {
+		case got == nil && tt.want == nil:
+		case got == nil || tt.want == nil:
+			t.Errorf("discountPercent(%v, %v) = %v, want %v", tt.rate, tt.onDemand, got, tt.want)
+		case *got-*tt.want > 1e-9 || *tt.want-*got > 1e-9:
+			t.Errorf("discountPercent(%v, %v) = %v, want %v", tt.rate, tt.onDemand, *got, *tt.want)
+		}
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
+
+func TestTermsOfSavingsPlans(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	items := []retailprices.PriceItem{{
+		SkuID: "DZH318Z0BQPS/00TG", MeterID: "m1", Type: retailprices.PriceTypeConsumption, RetailPrice: 0.2,
+		SavingsPlan: []retailprices.SavingsPlanRate{
+			{Term: "1 Year", RetailPrice: 0.15, UnitPrice: 0.15},
+			{Term: "3 Years", RetailPrice: 0.1, UnitPrice: 0.1},
+		},
+	}, {
+		// Free meters have no on-demand price to compare with
+		SkuID: "DZH318Z0BQPS/00TH", MeterID: "m2", Type: retailprices.PriceTypeConsumption,
+		SavingsPlan: []retailprices.SavingsPlanRate{{Term: "1 Year"}},
+	}}
+	prices := []*models.Price{{PriceID: 21, SkuID: 7, RetailPrice: 0.2}, {PriceID: 22, SkuID: 8}}
+
+	savingsPlans, reservations := termsOf(items, prices, now)
+	if len(reservations.terms) != 0 {
+		t.Errorf("got %d reservation terms from consumption items", len(reservations.terms))
+	}
+	want := []struct {
+		priceID uint
+		length  string
+		rate    float64
+		percent *float64
+	}{
+		{21, "1 Year", 0.15, ptr(25)},
+		{21, "3 Years", 0.1, ptr(50)},
+		{22, "1 Year", 0, nil},
+	}
+	if len(savingsPlans.terms) != len(want) {
+		t.Fatalf("got %d savings plan terms, want %d", len(savingsPlans.terms), len(want))
+	}
+	for i, w := range want {
+		term := savingsPlans.terms[i]
+		if term.PriceID != w.priceID || *term.PurchaseOption != termSavingsPlan || *term.LeaseContractLength != w.length {
+			t.Errorf("term %d: price %d, %s %s", i, term.PriceID, *term.PurchaseOption, *term.LeaseContractLength)
+		}
+		// The hourly rate is stored as published, next to the price it discounts
+		if *term.DiscountedRate != w.rate || *term.UnitPrice != w.rate {
+			t.Errorf("term %d: rate %v, unit price %v, want %v", i, *term.DiscountedRate, *term.UnitPrice, w.rate)
+		}
+		if term.OnDemandPriceID == nil || *term.OnDemandPriceID != w.priceID {
+			t.Errorf("term %d: on-demand price %v, want %d", i, term.OnDemandPriceID, w.priceID)
+		}
+		if (term.DiscountPercent == nil) != (w.percent == nil) ||
+			(w.percent != nil && (*term.DiscountPercent-*w.percent > 1e-9 || *w.percent-*term.DiscountPercent > 1e-9)) {
+			t.Errorf("term %d: discount %v, want %v", i, term.DiscountPercent, w.percent)
+		}
+	}
+}
+
+func TestUpsertSavingsPlanTerms(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	savingsPlans, _ := termsOf(
+		[]retailprices.PriceItem{{Type: retailprices.PriceTypeConsumption, RetailPrice: 0.2, SavingsPlan: []retailprices.SavingsPlanRate{{Term: "3 Years", RetailPrice: 0.1, UnitPrice: 0.1}}}},
+		[]*models.Price{{PriceID: 21, SkuID: 7, RetailPrice: 0.2}},
+		time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	)
+	if err := upsertTerms(db, savingsPlans.terms, "sku_id", "discounted_rate", "unit_price", "on_demand_price_id", "discount_percent", "modified_date"); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := recorder.last(t)
+	for _, want := range []string{
+		"(NULL,21,7,'SavingsPlan','3 Years',NULL,0.1,0.1,NULL,21,50,false,",
+		`"on_demand_price_id"="excluded"."on_demand_price_id","discount_percent"="excluded"."discount_percent"`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("statement lacks %q:\n%s", want, sql)
+		}
+	}
+}
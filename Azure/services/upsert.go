@@ -0,0 +1,283 @@
+package services
+
+import (
+	"cco_backend/models"
+	"cco_backend/retailprices"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upsertBatchSize bounds the rows sent in a single INSERT ... ON CONFLICT statement
+const upsertBatchSize = 500
+
+// skuKey is the natural key of a Sku row: the API skuId in one region, listed once per
+// price type. Regions are rows of one cloud, so the region ID also fixes the cloud.
+type skuKey struct {
+	code      string
+	regionID  uint
+	usageType string
+}
+
+// priceKey is the natural key of a Price row
+type priceKey struct {
+	skuID           int
+	meterID         string
+	effective       time.Time
+	tier            float64
+	currency        string
+	priceType       string
+	reservationTerm string
+}
+
+func priceKeyOf(price models.Price) priceKey {
+	return priceKey{price.SkuID, price.MeterID, price.EffectiveDate.UTC(), price.TierMinimumUnits, price.CurrencyCode, price.PriceType, price.ReservationTerm}
+}
+
+// skuIDsFor loads the IDs of the SKU rows the items belong to with a single query. The
+// region of every item is resolved through regions, which only knows the regions of the
+// run's cloud, so SKUs of another cloud with the same skuId are never matched.
+func skuIDsFor(tx *gorm.DB, regions *regionCache, items []retailprices.PriceItem) (map[skuKey]int, []uint, error) {
+	regionIDs := make([]uint, len(items))
+	codes := make([]string, 0, len(items))
+	seenCodes, seenRegions := map[string]bool{}, map[uint]bool{}
+	var regionList []uint
+	for i, item := range items {
+		regionID, ok, err := regions.lookup(tx, item.ArmRegionName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		regionIDs[i] = regionID
+		if !seenRegions[regionID] {
+			seenRegions[regionID] = true
+			regionList = append(regionList, regionID)
+		}
+		if !seenCodes[item.SkuID] {
+			seenCodes[item.SkuID] = true
+			codes = append(codes, item.SkuID)
+		}
+	}
+
+	ids := make(map[skuKey]int, len(codes))
+	if len(codes) == 0 {
+		return ids, regionIDs, nil
+	}
+	var skus []models.Sku
+	err := tx.Select("id", "sku_id_api", "region_id", "type").
+		Where("sku_id_api IN ? AND region_id IN ?", codes, regionList).
+		Find(&skus).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading SKUs: %w", err)
+	}
+	for _, sku := range skus {
+		if sku.SkuCode != nil {
+			ids[skuKey{*sku.SkuCode, sku.RegionID, sku.UsageType}] = int(sku.ID)
+		}
+	}
+	return ids, regionIDs, nil
+}
+
+// findPrices returns the Price row of every item, in item order, nil for items whose
+// price has not been written. It reads the rows the price sink wrote for the same page,
+// or an earlier run wrote, without writing them again.
+func findPrices(tx *gorm.DB, regions *regionCache, items []retailprices.PriceItem) ([]*models.Price, error) {
+	skuIDs, regionIDs, err := skuIDsFor(tx, regions, items)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]priceKey, len(items))
+	found := make([]bool, len(items))
+	var skus []int
+	var meters []string
+	seenSkus, seenMeters := map[int]bool{}, map[string]bool{}
+	for i, item := range items {
+		skuID, ok := skuIDs[skuKey{item.SkuID, regionIDs[i], item.Type}]
+		if !ok {
+			continue
+		}
+		found[i] = true
+		keys[i] = priceKey{skuID, item.MeterID, item.EffectiveStartDate.UTC(), item.TierMinimumUnits, item.CurrencyCode, item.Type, item.ReservationTerm}
+		if !seenSkus[skuID] {
+			seenSkus[skuID] = true
+			skus = append(skus, skuID)
+		}
+		if !seenMeters[item.MeterID] {
+			seenMeters[item.MeterID] = true
+			meters = append(meters, item.MeterID)
+		}
+	}
+
+	prices := make([]*models.Price, len(items))
+	if len(skus) == 0 {
+		return prices, nil
+	}
+	var rows []models.Price
+	err = tx.Select("price_id", "sku_id", "meter_id", "effective_date", "tier_minimum_units", "currency_code", "price_type", "reservation_term", "retail_price").
+		Where("sku_id IN ? AND meter_id IN ?", skus, meters).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error loading prices: %w", err)
+	}
+	byKey := make(map[priceKey]*models.Price, len(rows))
+	for i := range rows {
+		byKey[priceKeyOf(rows[i])] = &rows[i]
+	}
+	for i := range items {
+		if found[i] {
+			prices[i] = byKey[keys[i]]
+		}
+	}
+	return prices, nil
+}
+
+// upsertPrices writes one Price row per item whose SKU has been imported. It returns
+// the written row of every item, in item order, nil for items that were skipped.
+// Writing the same items again updates the rows in place.
+func upsertPrices(tx *gorm.DB, regions *regionCache, page *retailprices.PricesPage, items []retailprices.PriceItem) ([]*models.Price, error) {
+	skuIDs, regionIDs, err := skuIDsFor(tx, regions, items)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rows := make([]models.Price, 0, len(items))
+	rowOf := make([]int, len(items)) // index into rows per item, -1 when skipped
+	index := map[priceKey]int{}
+	for i, item := range items {
+		rowOf[i] = -1
+		skuID, ok := skuIDs[skuKey{item.SkuID, regionIDs[i], item.Type}]
+		if !ok {
+			log.Printf("SKU not found for skuId: %s, skipping...", item.SkuID)
+			continue
+		}
+
+		class := retailprices.ClassifyVMPrice(item)
+		price := models.Price{
+			SkuID:                skuID,
+			MeterID:              item.MeterID,
+			TierMinimumUnits:     item.TierMinimumUnits,
+			RetailPrice:          item.RetailPrice,
+			UnitPrice:            item.UnitPrice,
+			Unit:                 item.UnitOfMeasure,
+			EffectiveDate:        item.EffectiveStartDate.UTC(),
+			EffectiveEndDate:     item.EffectiveEndDate,
+			CurrencyCode:         item.CurrencyCode,
+			BillingCurrency:      page.BillingCurrency,
+			PriceType:            item.Type,
+			ReservationTerm:      item.ReservationTerm,
+			ProductID:            item.ProductID,
+			Location:             item.Location,
+			IsPrimaryMeterRegion: item.IsPrimaryMeterRegion,
+			OperatingSystem:      class.OperatingSystem,
+			LicenseModel:         class.LicenseModel,
+			Priority:             class.Priority,
+			DevTestEligible:      class.DevTestEligible,
+			CreatedAt:            now,
+			ModifiedAt:           now,
+		}
+		// A statement may not update the same row twice, so later duplicates win
+		key := priceKeyOf(price)
+		if existing, ok := index[key]; ok {
+			rows[existing] = price
+			rowOf[i] = existing
+			continue
+		}
+		index[key] = len(rows)
+		rowOf[i] = len(rows)
+		rows = append(rows, price)
+	}
+
+	written := make([]*models.Price, len(items))
+	if len(rows) == 0 {
+		return written, nil
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "sku_id"}, {Name: "meter_id"}, {Name: "effective_date"}, {Name: "tier_minimum_units"},
+			{Name: "currency_code"}, {Name: "price_type"}, {Name: "reservation_term"},
+		},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"retail_price", "unit_price", "unit", "effective_end_date", "billing_currency",
+			"product_id", "location", "is_primary_meter_region", "operating_system", "license_model",
+			"priority", "dev_test_eligible", "modified_at",
+		}),
+	}).CreateInBatches(&rows, upsertBatchSize).Error
+	if err != nil {
+		return nil, fmt.Errorf("error upserting prices: %w", err)
+	}
+	if err := closeOutPrices(tx, rows); err != nil {
+		return nil, err
+	}
+
+	for i, row := range rowOf {
+		if row >= 0 {
+			written[i] = &rows[row]
+		}
+	}
+	return written, nil
+}
+
+// closeOutPrices ends every superseded price of the price series written in rows. A
+// price series is one meter and tier of a SKU in one currency, price type and
+// reservation term; each price in it ends
+// where the next newer one starts and is disabled, so only the newest price of a series
+// stays enabled. Prices can arrive in any order, so the whole series is recomputed, and
+// an end date published by the API is kept when it comes before the successor. Series
+// without a row in this page are left alone.
+func closeOutPrices(tx *gorm.DB, rows []models.Price) error {
+	series := priceSeries(rows)
+	if len(series) == 0 {
+		return nil
+	}
+
+	err := tx.Exec(`
+		UPDATE prices p
+		SET effective_end_date = LEAST(COALESCE(p.effective_end_date, s.next_start), s.next_start),
+			disable_flag = true,
+			modified_at = ?
+		FROM (
+			SELECT price_id, LEAD(effective_date) OVER (
+				PARTITION BY sku_id, meter_id, tier_minimum_units, currency_code, price_type, reservation_term
+				ORDER BY effective_date
+			) AS next_start
+			FROM prices
+			WHERE (sku_id, meter_id, tier_minimum_units, currency_code, price_type, reservation_term) IN ?
+		) s
+		WHERE p.price_id = s.price_id
+			AND s.next_start IS NOT NULL
+			AND (p.effective_end_date IS NULL OR p.effective_end_date > s.next_start OR NOT p.disable_flag)`,
+		time.Now(), series).Error
+	if err != nil {
+		return fmt.Errorf("error closing out superseded prices: %w", err)
+	}
+	return nil
+}
+
+// priceSeries returns the distinct price series of rows, in the column order used by
+// closeOutPrices
+func priceSeries(rows []models.Price) [][]interface{} {
+	type seriesKey struct {
+		skuID                                int
+		meterID                              string
+		tier                                 float64
+		currency, priceType, reservationTerm string
+	}
+	seen := map[seriesKey]bool{}
+	var series [][]interface{}
+	for _, row := range rows {
+		key := seriesKey{row.SkuID, row.MeterID, row.TierMinimumUnits, row.CurrencyCode, row.PriceType, row.ReservationTerm}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		series = append(series, []interface{}{key.skuID, key.meterID, key.tier, key.currency, key.priceType, key.reservationTerm})
+	}
+	return series
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"cco_backend/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPriceSeries(t *testing.T) {
+	rows := []models.Price{
+		{SkuID: 1, MeterID: "m1", CurrencyCode: "USD", PriceType: "Consumption"},
+		{SkuID: 1, MeterID: "m1", CurrencyCode: "USD", PriceType: "Consumption"}, // newer price of the same series
+		{SkuID: 1, MeterID: "m1", TierMinimumUnits: 1.5, CurrencyCode: "USD", PriceType: "Consumption"},
+		{SkuID: 1, MeterID: "m1", CurrencyCode: "EUR", PriceType: "Consumption"},
+		{SkuID: 2, MeterID: "m2", CurrencyCode: "USD", PriceType: "Reservation", ReservationTerm: "1 Year"},
+		{SkuID: 2, MeterID: "m2", CurrencyCode: "USD", PriceType: "Reservation", ReservationTerm: "3 Years"},
+	}
+	want := [][]interface{}{
+		{1, "m1", 0.0, "USD", "Consumption", ""},
+		{1, "m1", 1.5, "USD", "Consumption", ""},
+		{1, "m1", 0.0, "EUR", "Consumption", ""},
+		{2, "m2", 0.0, "USD", "Reservation", "1 Year"},
+		{2, "m2", 0.0, "USD", "Reservation", "3 Years"},
+	}
+	if got := priceSeries(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCloseOutPrices(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	rows := []models.Price{
+		{SkuID: 1, MeterID: "m1", CurrencyCode: "USD", PriceType: "Consumption"},
+		{SkuID: 2, MeterID: "m2", CurrencyCode: "EUR", PriceType: "Reservation", ReservationTerm: "3 Years"},
+	}
+	if err := closeOutPrices(db, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := recorder.last(t)
+	for _, want := range []string{
+		// Only the series of the page are recomputed
+		"FROM prices WHERE (sku_id, meter_id, tier_minimum_units, currency_code, price_type, reservation_term) IN ((1,'m1',0,'USD','Consumption',''),(2,'m2',0,'EUR','Reservation','3 Years'))",
+		"PARTITION BY sku_id, meter_id, tier_minimum_units, currency_code, price_type, reservation_term ORDER BY effective_date",
+		// A published end date before the successor is kept
+		"effective_end_date = LEAST(COALESCE(p.effective_end_date, s.next_start), s.next_start)",
+		"disable_flag = true",
+		// The newest price of a series has no successor and stays open
+		"s.next_start IS NOT NULL",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("statement lacks %q:\n%s", want, sql)
+		}
+	}
+
+	// A page without prices has nothing to close out
+	recorder.statements = nil
+	if err := closeOutPrices(db, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.statements) != 0 {
+		t.Errorf("empty page ran %v", recorder.statements)
+	}
+}
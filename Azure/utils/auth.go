@@ -1,81 +1,79 @@
 package utils
- 
+
 import (
-    "bytes"
-    "encoding/json"
-    "errors"
-    "fmt"
-    "io/ioutil"
-    "log"
-    "net/http"
-    "os"
- 
-    "github.com/joho/godotenv"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
 )
- 
+
 func init() {
-    err := godotenv.Load()
-    if err != nil {
-        log.Println("Warning: No .env file found. Environment variables must be set manually.")
-    }
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Warning: No .env file found. Environment variables must be set manually.")
+	}
+}
+
+// GenerateBearerToken returns a bearer token for Resource Manager access in the cloud
+// selected by AZURE_CLOUD. Tokens come from DefaultTokenProvider, so repeated calls
+// reuse a cached token.
+func GenerateBearerToken(ctx context.Context) (string, error) {
+	cloud, err := CurrentCloud()
+	if err != nil {
+		return "", err
+	}
+	return DefaultTokenProvider().Token(ctx, cloud.TokenScope)
+}
+
+// postTokenRequest posts a form-encoded OAuth2 token request and decodes the response
+func postTokenRequest(ctx context.Context, tokenURL string, payload url.Values) (AccessToken, error) {
+	encoded := payload.Encode()
+	body, err := doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("error making token request: %w", err)
+	}
+
+	return decodeTokenResponse(body)
+}
+
+// decodeTokenResponse reads access_token and its lifetime from a token endpoint response.
+// expires_in is a number of seconds, sent as a JSON number or as a string depending on
+// the endpoint.
+func decodeTokenResponse(body []byte) (AccessToken, error) {
+	var responseData struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return AccessToken{}, fmt.Errorf("error decoding response: %w", err)
+	}
+	if responseData.AccessToken == "" {
+		return AccessToken{}, errors.New("access_token not found in response")
+	}
+
+	seconds, err := strconv.Atoi(strings.Trim(string(responseData.ExpiresIn), `"`))
+	if err != nil || seconds <= 0 {
+		// Without a lifetime assume the usual hour, the provider refreshes well before it
+		seconds = 3600
+	}
+
+	return AccessToken{
+		Token:     responseData.AccessToken,
+		ExpiresOn: time.Now().Add(time.Duration(seconds) * time.Second),
+	}, nil
 }
- 
-// GenerateBearerToken generates a bearer token for Azure API access
-func GenerateBearerToken() (string, error) {
-    clientID := os.Getenv("AZURE_CLIENT_ID")
-    clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
-    tenantID := os.Getenv("AZURE_TENANT_ID")
- 
-    // Validate environment variables
-    if clientID == "" || clientSecret == "" || tenantID == "" {
-        missing := []string{}
-        if clientID == "" {
-            missing = append(missing, "AZURE_CLIENT_ID")
-        }
-        if clientSecret == "" {
-            missing = append(missing, "AZURE_CLIENT_SECRET")
-        }
-        if tenantID == "" {
-            missing = append(missing, "AZURE_TENANT_ID")
-        }
-        return "", fmt.Errorf("missing required environment variables: %v", missing)
-    }
- 
-    url := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID)
- 
-    payload := map[string]string{
-        "client_id":     clientID,
-        "client_secret": clientSecret,
-        "grant_type":    "client_credentials",
-        "scope":         "https://management.azure.com/.default",
-    }
- 
-    payloadBytes := []byte{}
-    for key, value := range payload {
-        payloadBytes = append(payloadBytes, []byte(fmt.Sprintf("%s=%s&", key, value))...)
-    }
-    payloadBytes = payloadBytes[:len(payloadBytes)-1]
- 
-    resp, err := http.Post(url, "application/x-www-form-urlencoded", bytes.NewBuffer(payloadBytes))
-    if err != nil {
-        return "", fmt.Errorf("error making token request: %w", err)
-    }
-    defer resp.Body.Close()
- 
-    if resp.StatusCode != http.StatusOK {
-        body, _ := ioutil.ReadAll(resp.Body)
-        return "", fmt.Errorf("non-200 response: %d, body: %s", resp.StatusCode, string(body))
-    }
- 
-    var responseData map[string]interface{}
-    if err := json.NewDecoder(resp.Body).Decode(&responseData); err != nil {
-        return "", fmt.Errorf("error decoding response: %w", err)
-    }
- 
-    token, ok := responseData["access_token"].(string)
-    if !ok {
-        return "", errors.New("access_token not found in response")
-    }
- 
-    return token, nil
-}
\ No newline at end of file
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// clientAssertionLifetime is how long a signed client assertion is accepted for
+const clientAssertionLifetime = 10 * time.Minute
+
+// clientCertificate is an app registration certificate and its RSA private key
+type clientCertificate struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// loadClientCertificate reads a certificate and its private key from a PEM file, or
+// from a PFX file when the path ends in .pfx or .p12
+func loadClientCertificate(path, password string) (*clientCertificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client certificate: %w", err)
+	}
+
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".pfx") || strings.HasSuffix(lower, ".p12") {
+		blocks, err := pkcs12.ToPEM(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding PFX client certificate: %w", err)
+		}
+		data = nil
+		for _, block := range blocks {
+			data = append(data, pem.EncodeToMemory(block)...)
+		}
+	}
+
+	return parseClientCertificatePEM(data)
+}
+
+// parseClientCertificatePEM takes the first certificate and the first RSA private key
+// found in PEM data, in any order
+func parseClientCertificatePEM(data []byte) (*clientCertificate, error) {
+	result := &clientCertificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch {
+		case block.Type == "CERTIFICATE" && result.cert == nil:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing client certificate: %w", err)
+			}
+			result.cert = cert
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && result.key == nil:
+			key, err := parseRSAPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			result.key = key
+		}
+	}
+
+	if result.cert == nil {
+		return nil, errors.New("no certificate found in client certificate file")
+	}
+	if result.key == nil {
+		return nil, errors.New("no private key found in client certificate file")
+	}
+	return result, nil
+}
+
+// parseRSAPrivateKey accepts PKCS#1 and PKCS#8 encoded RSA keys; Azure AD only accepts
+// RS256 client assertions
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing client certificate private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("client certificate private key is %T, only RSA keys are supported", parsed)
+	}
+	return key, nil
+}
+
+// assertion returns a JWT signed with the certificate key that identifies clientID to
+// the token endpoint at audience. The x5t header carries the certificate thumbprint so
+// Azure AD can pick the matching registered certificate.
+func (c *clientCertificate) assertion(clientID, audience string) (string, error) {
+	thumbprint := sha1.Sum(c.cert.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("error generating assertion id: %w", err)
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing client assertion: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
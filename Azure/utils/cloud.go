@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Cloud bundles the endpoints of one Azure cloud environment
+type Cloud struct {
+	Name                    string
+	AuthorityHost           string // Azure AD authority, without trailing slash
+	ResourceManagerEndpoint string // ARM endpoint, without trailing slash
+	TokenScope              string // scope of ARM access tokens
+	PricingEndpoint         string // Retail Prices API, empty when the cloud has none
+	// RegionPrefixes are the prefixes of the region names that belong to this cloud.
+	// The public cloud has none and owns every region no other cloud claims.
+	RegionPrefixes []string
+}
+
+// Names of the built-in clouds accepted in AZURE_CLOUD
+const (
+	AzurePublic       = "AzurePublic"
+	AzureUSGovernment = "AzureUSGovernment"
+	AzureChina        = "AzureChina"
+)
+
+// clouds are the built-in cloud environments. Azure Government prices are published
+// by the public Retail Prices API under the usgov* regions; Azure China has no public
+// retail prices endpoint, so one has to be configured with AZURE_PRICE_ENDPOINT.
+var clouds = map[string]Cloud{
+	AzurePublic: {
+		Name:                    AzurePublic,
+		AuthorityHost:           "https://login.microsoftonline.com",
+		ResourceManagerEndpoint: "https://management.azure.com",
+		TokenScope:              "https://management.azure.com/.default",
+		PricingEndpoint:         "https://prices.azure.com/api/retail/prices",
+	},
+	AzureUSGovernment: {
+		Name:                    AzureUSGovernment,
+		AuthorityHost:           "https://login.microsoftonline.us",
+		ResourceManagerEndpoint: "https://management.usgovcloudapi.net",
+		TokenScope:              "https://management.usgovcloudapi.net/.default",
+		PricingEndpoint:         "https://prices.azure.com/api/retail/prices",
+		RegionPrefixes:          []string{"usgov", "usdod", "ussec", "usnat"},
+	},
+	AzureChina: {
+		Name:                    AzureChina,
+		AuthorityHost:           "https://login.chinacloudapi.cn",
+		ResourceManagerEndpoint: "https://management.chinacloudapi.cn",
+		TokenScope:              "https://management.chinacloudapi.cn/.default",
+		RegionPrefixes:          []string{"china"},
+	},
+}
+
+// HasRegion reports whether the region belongs to the cloud. Both ARM names
+// (usgovvirginia) and display names (US Gov Virginia) are accepted, since the price feed
+// falls back to the display location for meters without an ARM region.
+func (c Cloud) HasRegion(region string) bool {
+	name := strings.ToLower(strings.ReplaceAll(region, " ", ""))
+	if name == "" {
+		return false
+	}
+	if len(c.RegionPrefixes) > 0 {
+		return hasAnyPrefix(name, c.RegionPrefixes)
+	}
+	for _, other := range clouds {
+		if other.Name != c.Name && hasAnyPrefix(name, other.RegionPrefixes) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupCloud returns the built-in cloud with the given name, ignoring case
+func LookupCloud(name string) (Cloud, error) {
+	for key, cloud := range clouds {
+		if strings.EqualFold(key, name) {
+			return cloud, nil
+		}
+	}
+
+	names := make([]string, 0, len(clouds))
+	for key := range clouds {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return Cloud{}, fmt.Errorf("unknown cloud %q, expected one of %v", name, names)
+}
+
+// CurrentCloud returns the cloud selected by AZURE_CLOUD (default AzurePublic). Single
+// endpoints can be overridden with AZURE_AUTHORITY_HOST, AZURE_RESOURCE_MANAGER_ENDPOINT
+// and AZURE_PRICE_ENDPOINT, for example to point at a local stand-in; overriding the
+// ARM endpoint also moves the token scope.
+func CurrentCloud() (Cloud, error) {
+	name := strings.TrimSpace(os.Getenv("AZURE_CLOUD"))
+	if name == "" {
+		name = AzurePublic
+	}
+	cloud, err := LookupCloud(name)
+	if err != nil {
+		return Cloud{}, err
+	}
+
+	if host := os.Getenv("AZURE_AUTHORITY_HOST"); host != "" {
+		cloud.AuthorityHost = host
+	}
+	if endpoint := os.Getenv("AZURE_RESOURCE_MANAGER_ENDPOINT"); endpoint != "" {
+		cloud.ResourceManagerEndpoint = endpoint
+		cloud.TokenScope = strings.TrimRight(endpoint, "/") + "/.default"
+	}
+	if endpoint := os.Getenv("AZURE_PRICE_ENDPOINT"); endpoint != "" {
+		cloud.PricingEndpoint = endpoint
+	}
+	cloud.AuthorityHost = strings.TrimRight(cloud.AuthorityHost, "/")
+	cloud.ResourceManagerEndpoint = strings.TrimRight(cloud.ResourceManagerEndpoint, "/")
+	return cloud, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestCloudHasRegion(t *testing.T) {
+	tests := []struct {
+		cloud  string
+		region string
+		want   bool
+	}{
+		{AzurePublic, "eastus", true},
+		{AzurePublic, "Global", true},
+		{AzurePublic, "usgovvirginia", false},
+		{AzurePublic, "US Gov Virginia", false},
+		{AzurePublic, "chinanorth3", false},
+		{AzureUSGovernment, "usgovarizona", true},
+		{AzureUSGovernment, "usdodeast", true},
+		{AzureUSGovernment, "US Gov Texas", true},
+		{AzureUSGovernment, "eastus", false},
+		{AzureUSGovernment, "Global", false},
+		{AzureChina, "chinaeast2", true},
+		{AzureChina, "westeurope", false},
+		{AzurePublic, "", false},
+	}
+	for _, tt := range tests {
+		cloud, err := LookupCloud(tt.cloud)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cloud.HasRegion(tt.region); got != tt.want {
+			t.Errorf("%s.HasRegion(%q) = %v, want %v", tt.cloud, tt.region, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Credential types accepted in AZURE_CREDENTIAL_TYPE
+const (
+	CredentialSecret      = "secret"
+	CredentialCertificate = "certificate"
+	CredentialWorkload    = "workload"
+	CredentialManaged     = "managed"
+	CredentialChain       = "chain"
+)
+
+// defaultCredentialChain is the order sources are tried in when AZURE_CREDENTIAL_TYPE is
+// "chain" or not set. Managed identity comes last since it is the only source that does
+// not need any configuration and so cannot tell up front whether it will work.
+var defaultCredentialChain = []string{CredentialCertificate, CredentialWorkload, CredentialSecret, CredentialManaged}
+
+const (
+	defaultManagedIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	clientAssertionType            = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// errCredentialUnavailable marks a source that is not configured, so a chain skips it
+// without sending a request
+var errCredentialUnavailable = errors.New("credential not configured")
+
+// CredentialConfig selects how Azure AD tokens are obtained
+type CredentialConfig struct {
+	// Types lists the credential sources to try in order
+	Types []string
+
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// CertificatePath points to a PEM or PFX file holding the certificate and its key
+	CertificatePath     string
+	CertificatePassword string
+
+	// FederatedTokenFile is the projected service-account token used for workload
+	// identity federation; it is re-read on every request since it is rotated on disk
+	FederatedTokenFile string
+
+	// AuthorityHost and ManagedIdentityEndpoint can point to a local stand-in token
+	// endpoint for testing
+	AuthorityHost           string
+	ManagedIdentityEndpoint string
+	// ManagedIdentityClientID selects a user-assigned identity; empty uses the
+	// system-assigned one
+	ManagedIdentityClientID string
+}
+
+// LoadCredentialConfig reads the credential configuration from the environment:
+//
+//	AZURE_CREDENTIAL_TYPE                  secret, certificate, workload, managed, or a
+//	                                       comma-separated list of them tried in order
+//	                                       (default "chain": certificate, workload,
+//	                                       secret, managed)
+//	AZURE_TENANT_ID, AZURE_CLIENT_ID       app registration used by all but managed
+//	AZURE_CLIENT_SECRET                    client secret
+//	AZURE_CLIENT_CERTIFICATE_PATH          PEM or PFX file with certificate and key
+//	AZURE_CLIENT_CERTIFICATE_PASSWORD      PFX password
+//	AZURE_FEDERATED_TOKEN_FILE             projected token for workload identity
+//	AZURE_AUTHORITY_HOST                   default https://login.microsoftonline.com
+//	AZURE_MANAGED_IDENTITY_ENDPOINT        default is the IMDS token endpoint
+//	AZURE_MANAGED_IDENTITY_CLIENT_ID       user-assigned managed identity
+func LoadCredentialConfig() (CredentialConfig, error) {
+	cloud, err := CurrentCloud()
+	if err != nil {
+		return CredentialConfig{}, err
+	}
+
+	var types []string
+	for _, name := range strings.Split(os.Getenv("AZURE_CREDENTIAL_TYPE"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			types = append(types, name)
+		}
+	}
+	if len(types) == 0 || (len(types) == 1 && types[0] == CredentialChain) {
+		types = append([]string(nil), defaultCredentialChain...)
+	}
+
+	managedEndpoint := os.Getenv("AZURE_MANAGED_IDENTITY_ENDPOINT")
+	if managedEndpoint == "" {
+		managedEndpoint = defaultManagedIdentityEndpoint
+	}
+
+	return CredentialConfig{
+		Types:                   types,
+		TenantID:                os.Getenv("AZURE_TENANT_ID"),
+		ClientID:                os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:            os.Getenv("AZURE_CLIENT_SECRET"),
+		CertificatePath:         os.Getenv("AZURE_CLIENT_CERTIFICATE_PATH"),
+		CertificatePassword:     os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD"),
+		FederatedTokenFile:      os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		AuthorityHost:           cloud.AuthorityHost,
+		ManagedIdentityEndpoint: managedEndpoint,
+		ManagedIdentityClientID: os.Getenv("AZURE_MANAGED_IDENTITY_CLIENT_ID"),
+	}, nil
+}
+
+// NewCredential returns the TokenSource described by cfg. A single type is used as is;
+// several types are combined into a chain that returns the first token obtained.
+func NewCredential(cfg CredentialConfig) (TokenSource, error) {
+	if len(cfg.Types) == 0 {
+		return nil, errors.New("no credential type configured")
+	}
+
+	sources := make([]namedSource, 0, len(cfg.Types))
+	for _, name := range cfg.Types {
+		source, err := credentialSource(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, namedSource{name: name, source: source})
+	}
+	if len(sources) == 1 {
+		return sources[0].source, nil
+	}
+	return chainCredential(sources), nil
+}
+
+func credentialSource(cfg CredentialConfig, name string) (TokenSource, error) {
+	switch name {
+	case CredentialSecret:
+		return clientSecretCredential(cfg), nil
+	case CredentialCertificate:
+		return certificateCredential(cfg), nil
+	case CredentialWorkload:
+		return workloadIdentityCredential(cfg), nil
+	case CredentialManaged:
+		return managedIdentityCredential(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown credential type %q", name)
+	}
+}
+
+// tokenEndpoint returns the OAuth2 v2.0 token endpoint of the tenant at the authority host
+func (cfg CredentialConfig) tokenEndpoint() string {
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", cfg.AuthorityHost, cfg.TenantID)
+}
+
+// requireEnv reports the variables of a credential that are not set
+func requireEnv(name string, values map[string]string) error {
+	var missing []string
+	for env, value := range values {
+		if value == "" {
+			missing = append(missing, env)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("%s %w, missing %v", name, errCredentialUnavailable, missing)
+}
+
+// clientSecretCredential authenticates the app registration with its client secret
+func clientSecretCredential(cfg CredentialConfig) TokenSource {
+	return func(ctx context.Context, scope string) (AccessToken, error) {
+		if err := requireEnv(CredentialSecret, map[string]string{
+			"AZURE_CLIENT_ID":     cfg.ClientID,
+			"AZURE_CLIENT_SECRET": cfg.ClientSecret,
+			"AZURE_TENANT_ID":     cfg.TenantID,
+		}); err != nil {
+			return AccessToken{}, err
+		}
+
+		return postTokenRequest(ctx, cfg.tokenEndpoint(), url.Values{
+			"client_id":     {cfg.ClientID},
+			"client_secret": {cfg.ClientSecret},
+			"grant_type":    {"client_credentials"},
+			"scope":         {scope},
+		})
+	}
+}
+
+// certificateCredential authenticates the app registration with a JWT client assertion
+// signed by the key of its certificate. The certificate is loaded on first use.
+func certificateCredential(cfg CredentialConfig) TokenSource {
+	var (
+		once    sync.Once
+		cert    *clientCertificate
+		loadErr error
+	)
+	return func(ctx context.Context, scope string) (AccessToken, error) {
+		if err := requireEnv(CredentialCertificate, map[string]string{
+			"AZURE_CLIENT_ID":               cfg.ClientID,
+			"AZURE_CLIENT_CERTIFICATE_PATH": cfg.CertificatePath,
+			"AZURE_TENANT_ID":               cfg.TenantID,
+		}); err != nil {
+			return AccessToken{}, err
+		}
+
+		once.Do(func() {
+			cert, loadErr = loadClientCertificate(cfg.CertificatePath, cfg.CertificatePassword)
+		})
+		if loadErr != nil {
+			return AccessToken{}, loadErr
+		}
+
+		tokenURL := cfg.tokenEndpoint()
+		assertion, err := cert.assertion(cfg.ClientID, tokenURL)
+		if err != nil {
+			return AccessToken{}, err
+		}
+
+		return postTokenRequest(ctx, tokenURL, url.Values{
+			"client_id":             {cfg.ClientID},
+			"client_assertion":      {assertion},
+			"client_assertion_type": {clientAssertionType},
+			"grant_type":            {"client_credentials"},
+			"scope":                 {scope},
+		})
+	}
+}
+
+// workloadIdentityCredential exchanges the projected federated token for an Azure AD
+// token, as used by AKS workload identity
+func workloadIdentityCredential(cfg CredentialConfig) TokenSource {
+	return func(ctx context.Context, scope string) (AccessToken, error) {
+		if err := requireEnv(CredentialWorkload, map[string]string{
+			"AZURE_CLIENT_ID":            cfg.ClientID,
+			"AZURE_FEDERATED_TOKEN_FILE": cfg.FederatedTokenFile,
+			"AZURE_TENANT_ID":            cfg.TenantID,
+		}); err != nil {
+			return AccessToken{}, err
+		}
+
+		assertion, err := os.ReadFile(cfg.FederatedTokenFile)
+		if err != nil {
+			return AccessToken{}, fmt.Errorf("error reading federated token file: %w", err)
+		}
+
+		return postTokenRequest(ctx, cfg.tokenEndpoint(), url.Values{
+			"client_id":             {cfg.ClientID},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+			"client_assertion_type": {clientAssertionType},
+			"grant_type":            {"client_credentials"},
+			"scope":                 {scope},
+		})
+	}
+}
+
+// imdsProbeTimeout bounds the first managed identity request. Off Azure the IMDS
+// address is unreachable, and the chain should move on quickly instead of retrying it.
+const imdsProbeTimeout = time.Second
+
+// managedIdentityCredential requests a token from the instance metadata service. IMDS
+// takes a resource instead of a scope, so the "/.default" suffix is dropped.
+//
+// Until the endpoint has answered once, every request is a single attempt bounded by
+// imdsProbeTimeout, and a connection failure reports the credential as unavailable.
+// Once it has answered, requests are retried like any other.
+func managedIdentityCredential(cfg CredentialConfig) TokenSource {
+	var reachable atomic.Bool
+	return func(ctx context.Context, scope string) (AccessToken, error) {
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {strings.TrimSuffix(scope, "/.default")},
+		}
+		if cfg.ManagedIdentityClientID != "" {
+			query.Set("client_id", cfg.ManagedIdentityClientID)
+		}
+		endpoint := cfg.ManagedIdentityEndpoint + "?" + query.Encode()
+		newRequest := func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Metadata", "true")
+			return req, nil
+		}
+
+		if !reachable.Load() {
+			body, err := probeManagedIdentity(ctx, newRequest)
+			var httpErr *HTTPError
+			switch {
+			case err == nil:
+				reachable.Store(true)
+				return decodeTokenResponse(body)
+			case errors.As(err, &httpErr):
+				reachable.Store(true)
+				if !httpErr.Retryable() {
+					return AccessToken{}, fmt.Errorf("error making managed identity token request: %w", err)
+				}
+			default:
+				if ctx.Err() != nil {
+					return AccessToken{}, ctx.Err()
+				}
+				return AccessToken{}, fmt.Errorf("managed identity endpoint unreachable, %w: %v", errCredentialUnavailable, err)
+			}
+		}
+
+		body, err := doWithRetry(ctx, newRequest)
+		if err != nil {
+			return AccessToken{}, fmt.Errorf("error making managed identity token request: %w", err)
+		}
+		return decodeTokenResponse(body)
+	}
+}
+
+// probeManagedIdentity sends a single request bounded by imdsProbeTimeout
+func probeManagedIdentity(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) ([]byte, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, imdsProbeTimeout)
+	defer cancel()
+
+	req, err := newRequest(probeCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	return doOnce(req)
+}
+
+type namedSource struct {
+	name   string
+	source TokenSource
+}
+
+// chainCredential tries each source in order and returns the first token obtained.
+// The source that worked is remembered and tried first on later calls.
+func chainCredential(sources []namedSource) TokenSource {
+	var (
+		mu      sync.Mutex
+		current = -1
+	)
+	return func(ctx context.Context, scope string) (AccessToken, error) {
+		mu.Lock()
+		preferred := current
+		mu.Unlock()
+		if preferred >= 0 {
+			token, err := sources[preferred].source(ctx, scope)
+			if err == nil {
+				return token, nil
+			}
+			log.Printf("Credential %s failed: %v, trying the whole chain", sources[preferred].name, err)
+		}
+
+		var errs []error
+		for i, s := range sources {
+			if ctx.Err() != nil {
+				return AccessToken{}, ctx.Err()
+			}
+			token, err := s.source(ctx, scope)
+			if err != nil {
+				if !errors.Is(err, errCredentialUnavailable) {
+					log.Printf("Credential %s failed: %v", s.name, err)
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+				continue
+			}
+			mu.Lock()
+			if current != i {
+				log.Printf("Using %s credential", s.name)
+			}
+			current = i
+			mu.Unlock()
+			return token, nil
+		}
+		return AccessToken{}, fmt.Errorf("no credential in the chain returned a token: %w", errors.Join(errs...))
+	}
+}
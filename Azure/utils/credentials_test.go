@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testScope = "https://management.azure.com/.default"
+
+// tokenServer is a stand-in for the Azure AD token endpoint and IMDS. It records the
+// requests it receives and answers each one with a token named after the grant.
+type tokenServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	forms    []url.Values
+	requests []*http.Request
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	ts := &tokenServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ts.mu.Lock()
+		ts.forms = append(ts.forms, r.PostForm)
+		ts.requests = append(ts.requests, r)
+		ts.mu.Unlock()
+
+		token := "token-for-" + r.PostForm.Get("client_id")
+		if r.Method == http.MethodGet {
+			token = "imds-token-for-" + r.URL.Query().Get("resource")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": token, "expires_in": "3599"})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) lastForm() url.Values {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.forms[len(ts.forms)-1]
+}
+
+func (ts *tokenServer) lastRequest() *http.Request {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.requests[len(ts.requests)-1]
+}
+
+func fastRetries(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	ResetRetryBudget()
+}
+
+func TestClientSecretCredential(t *testing.T) {
+	fastRetries(t)
+	server := newTokenServer(t)
+	cfg := CredentialConfig{Types: []string{CredentialSecret}, TenantID: "tenant", ClientID: "app", ClientSecret: "s3cret", AuthorityHost: server.URL}
+
+	source, err := NewCredential(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := source(context.Background(), testScope)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if token.Token != "token-for-app" || time.Until(token.ExpiresOn) < 59*time.Minute {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if got := server.lastRequest().URL.Path; got != "/tenant/oauth2/v2.0/token" {
+		t.Errorf("token path = %s", got)
+	}
+	form := server.lastForm()
+	if form.Get("client_secret") != "s3cret" || form.Get("grant_type") != "client_credentials" || form.Get("scope") != testScope {
+		t.Errorf("unexpected form %v", form)
+	}
+}
+
+func TestCertificateCredential(t *testing.T) {
+	fastRetries(t)
+	server := newTokenServer(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "client.pem")
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CredentialConfig{Types: []string{CredentialCertificate}, TenantID: "tenant", ClientID: "app", CertificatePath: path, AuthorityHost: server.URL}
+	source, err := NewCredential(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source(context.Background(), testScope); err != nil {
+		t.Fatalf("token: %v", err)
+	}
+
+	form := server.lastForm()
+	if form.Get("client_assertion_type") != clientAssertionType || form.Get("client_secret") != "" {
+		t.Errorf("unexpected form %v", form)
+	}
+	parts := strings.Split(form.Get("client_assertion"), ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion is not a JWT: %q", form.Get("client_assertion"))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("assertion signature does not verify: %v", err)
+	}
+
+	var claims map[string]interface{}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "app" || claims["sub"] != "app" || claims["aud"] != server.URL+"/tenant/oauth2/v2.0/token" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func TestWorkloadIdentityCredential(t *testing.T) {
+	fastRetries(t)
+	server := newTokenServer(t)
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("federated-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CredentialConfig{Types: []string{CredentialWorkload}, TenantID: "tenant", ClientID: "app", FederatedTokenFile: path, AuthorityHost: server.URL}
+	source, err := NewCredential(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source(context.Background(), testScope); err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if form := server.lastForm(); form.Get("client_assertion") != "federated-jwt" || form.Get("client_assertion_type") != clientAssertionType {
+		t.Errorf("unexpected form %v", form)
+	}
+
+	// The file is rotated on disk and read again on the next request
+	if err := os.WriteFile(path, []byte("rotated-jwt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source(context.Background(), testScope); err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if form := server.lastForm(); form.Get("client_assertion") != "rotated-jwt" {
+		t.Errorf("rotated token not used: %v", form)
+	}
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+	fastRetries(t)
+	server := newTokenServer(t)
+	cfg := CredentialConfig{Types: []string{CredentialManaged}, ManagedIdentityEndpoint: server.URL + "/metadata/identity/oauth2/token", ManagedIdentityClientID: "user-assigned"}
+
+	source, err := NewCredential(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := source(context.Background(), testScope)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if token.Token != "imds-token-for-https://management.azure.com" {
+		t.Errorf("unexpected token %q", token.Token)
+	}
+	req := server.lastRequest()
+	if req.Header.Get("Metadata") != "true" || req.URL.Query().Get("client_id") != "user-assigned" || req.URL.Query().Get("api-version") == "" {
+		t.Errorf("unexpected IMDS request %s %v", req.URL, req.Header)
+	}
+}
+
+func TestManagedIdentityUnreachableFailsFast(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 6, BaseDelay: time.Second, MaxDelay: time.Minute})
+	ResetRetryBudget()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	endpoint := closed.URL
+	closed.Close()
+
+	source := managedIdentityCredential(CredentialConfig{ManagedIdentityEndpoint: endpoint})
+	start := time.Now()
+	_, err := source(context.Background(), testScope)
+	if !errors.Is(err, errCredentialUnavailable) {
+		t.Errorf("expected the credential to be reported unavailable, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*imdsProbeTimeout {
+		t.Errorf("unreachable endpoint took %s", elapsed)
+	}
+}
+
+func TestChainCredentialSkipsUnconfiguredSources(t *testing.T) {
+	fastRetries(t)
+	server := newTokenServer(t)
+	cfg := CredentialConfig{
+		Types:                   []string{CredentialCertificate, CredentialWorkload, CredentialSecret, CredentialManaged},
+		TenantID:                "tenant",
+		ClientID:                "app",
+		AuthorityHost:           server.URL,
+		ManagedIdentityEndpoint: server.URL + "/metadata/identity/oauth2/token",
+	}
+
+	source, err := NewCredential(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := source(context.Background(), testScope)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if !strings.HasPrefix(token.Token, "imds-token") {
+		t.Errorf("expected the managed identity token, got %q", token.Token)
+	}
+	if len(server.forms) != 1 {
+		t.Errorf("unconfigured sources sent %d requests", len(server.forms)-1)
+	}
+}
@@ -1,11 +1,13 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
 )
 
 func JSONResponse(c *gin.Context, code int, data interface{}) {
@@ -13,21 +15,38 @@ func JSONResponse(c *gin.Context, code int, data interface{}) {
 }
 
 // FetchData makes an HTTP GET request to the given URL and returns the response as a map
-func FetchData(url string) (map[string]interface{}, error) {
-	resp, err := http.Get(url)
+func FetchData(ctx context.Context, url string) (map[string]interface{}, error) {
+	body, err := FetchBody(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching data: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("received non-200 response: %d, body: %s", resp.StatusCode, body)
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w\nResponse body: %s", err, body)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return data, nil
+}
+
+// httpClient is shared by every outbound request made from this package
+var httpClient = &http.Client{}
+
+// FetchBody makes an HTTP GET request to the given URL and returns the raw response body.
+// Throttling and transient failures are retried according to the active RetryPolicy
+// until ctx is done.
+func FetchBody(ctx context.Context, url string) ([]byte, error) {
+	return doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", url, nil)
+	})
+}
+
+// FetchDataWithBearerToken fetches data from an authenticated API endpoint using a token
+// for scope from tokens. A 401 response is retried once with a freshly requested token.
+func FetchDataWithBearerToken(ctx context.Context, url string, tokens *TokenProvider, scope string) (map[string]interface{}, error) {
+	body, err := FetchBodyWithBearerToken(ctx, url, tokens, scope)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, err
 	}
 
 	var data map[string]interface{}
@@ -38,35 +57,37 @@ func FetchData(url string) (map[string]interface{}, error) {
 	return data, nil
 }
 
-// FetchDataWithBearerToken fetches data from an authenticated API endpoint
-func FetchDataWithBearerToken(url, bearerToken string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating HTTP request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error executing HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
+// FetchBodyWithBearerToken is FetchDataWithBearerToken returning the raw response body
+func FetchBodyWithBearerToken(ctx context.Context, url string, tokens *TokenProvider, scope string) ([]byte, error) {
+	body, err := fetchWithToken(ctx, url, tokens, scope)
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("received non-200 response: %d, body: %s", resp.StatusCode, body)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
+		log.Printf("Token for %s rejected, retrying with a new one", scope)
+		body, err = fetchWithToken(ctx, url, tokens, scope)
 	}
+	return body, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// fetchWithToken sends one authenticated GET request, invalidating the token on a 401
+func fetchWithToken(ctx context.Context, url string, tokens *TokenProvider, scope string) ([]byte, error) {
+	bearerToken, err := tokens.Token(ctx, scope)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, err
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("error unmarshaling JSON: %w\nResponse body: %s", err, body)
-	}
+	body, err := doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+		return req, nil
+	})
 
-	return data, nil
-}
\ No newline at end of file
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
+		tokens.Invalidate(scope, bearerToken)
+	}
+	return body, err
+}
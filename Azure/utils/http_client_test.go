@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bearerServer accepts only the tokens in valid and records the token of every request
+type bearerServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	valid map[string]bool
+	seen  []string
+}
+
+func newBearerServer(t *testing.T, valid ...string) *bearerServer {
+	bs := &bearerServer{valid: map[string]bool{}}
+	for _, token := range valid {
+		bs.valid[token] = true
+	}
+	bs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		bs.mu.Lock()
+		bs.seen = append(bs.seen, token)
+		ok := bs.valid[token]
+		bs.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(bs.Close)
+	return bs
+}
+
+func (bs *bearerServer) requests() []string {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return append([]string(nil), bs.seen...)
+}
+
+func TestFetchBodyWithBearerTokenRetriesOnceAfter401(t *testing.T) {
+	fastRetries(t)
+	server := newBearerServer(t, "Bearer arm#2")
+	src := &countingSource{lifetime: time.Hour}
+	tokens := NewTokenProvider(src.source)
+
+	body, err := FetchBodyWithBearerToken(context.Background(), server.URL, tokens, "arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"ok":true}` {
+		t.Errorf("got body %q", body)
+	}
+	if got := server.requests(); len(got) != 2 || got[0] != "Bearer arm#1" || got[1] != "Bearer arm#2" {
+		t.Errorf("got requests %v, want the rejected token and then a new one", got)
+	}
+
+	// The accepted token stays cached
+	if _, err := FetchBodyWithBearerToken(context.Background(), server.URL, tokens, "arm"); err != nil {
+		t.Fatal(err)
+	}
+	if src.count("arm") != 2 {
+		t.Errorf("source called %d times, want 2", src.count("arm"))
+	}
+}
+
+func TestFetchBodyWithBearerTokenGivesUpAfterSecond401(t *testing.T) {
+	fastRetries(t)
+	server := newBearerServer(t)
+	src := &countingSource{lifetime: time.Hour}
+
+	_, err := FetchBodyWithBearerToken(context.Background(), server.URL, NewTokenProvider(src.source), "arm")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401 error", err)
+	}
+	if got := server.requests(); len(got) != 2 {
+		t.Errorf("sent %d requests, want 2", len(got))
+	}
+}
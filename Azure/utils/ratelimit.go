@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit configures the request rate allowed against a single host
+type HostLimit struct {
+	RPS   float64 // sustained requests per second
+	Burst int     // requests that may be sent back to back after an idle period
+}
+
+// defaultHostLimits apply unless overridden by HTTP_RATE_LIMITS
+var defaultHostLimits = map[string]HostLimit{
+	"prices.azure.com":          {RPS: 5, Burst: 10},
+	"management.azure.com":      {RPS: 3, Burst: 6},
+	"login.microsoftonline.com": {RPS: 2, Burst: 4},
+
+	"management.usgovcloudapi.net": {RPS: 3, Burst: 6},
+	"login.microsoftonline.us":     {RPS: 2, Burst: 4},
+	"management.chinacloudapi.cn":  {RPS: 3, Burst: 6},
+	"login.chinacloudapi.cn":       {RPS: 2, Burst: 4},
+}
+
+// fallbackHostLimit applies to hosts without an explicit limit
+var fallbackHostLimit = HostLimit{RPS: 2, Burst: 4}
+
+// RateLimiter is a set of token buckets, one per host, whose rate is halved whenever
+// the host signals throttling and recovers gradually as requests succeed again
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]HostLimit
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter returns a RateLimiter using the given per-host limits
+func NewRateLimiter(limits map[string]HostLimit) *RateLimiter {
+	copied := make(map[string]HostLimit, len(limits))
+	for host, limit := range limits {
+		copied[host] = limit
+	}
+	return &RateLimiter{limits: copied, buckets: map[string]*tokenBucket{}}
+}
+
+// SetHostLimit changes the configured limit for host
+func (l *RateLimiter) SetHostLimit(host string, limit HostLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[host] = limit
+	delete(l.buckets, host)
+}
+
+// Wait blocks until a request to host is allowed or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	b := l.bucket(host)
+	err := ctx.Err()
+	if d := b.reserve(time.Now()); d > 0 {
+		err = sleepContext(ctx, d)
+	}
+	if err != nil {
+		// No request is sent, so the token goes back to the next caller
+		b.release()
+	}
+	return err
+}
+
+// Throttled lowers the rate for host and holds requests back for at least pause
+func (l *RateLimiter) Throttled(host string, pause time.Duration) {
+	rate := l.bucket(host).throttle(time.Now(), pause)
+	log.Printf("Throttled by %s, lowering rate to %.2f requests/s", host, rate)
+}
+
+// Succeeded lets the rate for host recover towards its configured limit
+func (l *RateLimiter) Succeeded(host string) {
+	l.bucket(host).recover()
+}
+
+func (l *RateLimiter) bucket(host string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[host]
+	if !ok {
+		limit, ok := l.limits[host]
+		if !ok {
+			limit = fallbackHostLimit
+		}
+		b = newTokenBucket(limit)
+		l.buckets[host] = b
+	}
+	return b
+}
+
+// tokenBucket is a single host's bucket. rate is the current, possibly lowered, refill
+// rate and never exceeds limit.RPS.
+type tokenBucket struct {
+	mu           sync.Mutex
+	limit        HostLimit
+	rate         float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newTokenBucket(limit HostLimit) *tokenBucket {
+	if limit.RPS <= 0 {
+		limit.RPS = fallbackHostLimit.RPS
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, rate: limit.RPS, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if burst := float64(b.limit.Burst); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.tokens--
+
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	if blocked := b.blockedUntil.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	return wait
+}
+
+// release returns a token taken by reserve whose request was never sent
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+	if burst := float64(b.limit.Burst); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+// throttle halves the rate, down to a floor of 1/16 of the limit, and drains the bucket
+func (b *tokenBucket) throttle(now time.Time, pause time.Duration) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate /= 2
+	if floor := b.limit.RPS / 16; b.rate < floor {
+		b.rate = floor
+	}
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+	if until := now.Add(pause); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	return b.rate
+}
+
+// recover raises the rate additively, reaching the limit again after about 50 successes
+func (b *tokenBucket) recover() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate += b.limit.RPS / 50
+	if b.rate > b.limit.RPS {
+		b.rate = b.limit.RPS
+	}
+}
+
+var (
+	sharedLimiter     *RateLimiter
+	sharedLimiterOnce sync.Once
+)
+
+// Limiter returns the rate limiter shared by every outbound request of this package.
+// Per-host limits can be overridden with HTTP_RATE_LIMITS, for example
+// "prices.azure.com=5:10,management.azure.com=3:6" (requests per second:burst).
+func Limiter() *RateLimiter {
+	sharedLimiterOnce.Do(func() {
+		sharedLimiter = NewRateLimiter(parseHostLimits(os.Getenv("HTTP_RATE_LIMITS"), defaultHostLimits))
+	})
+	return sharedLimiter
+}
+
+// parseHostLimits applies a "host=rps:burst,..." override list on top of defaults
+func parseHostLimits(spec string, defaults map[string]HostLimit) map[string]HostLimit {
+	limits := make(map[string]HostLimit, len(defaults))
+	for host, limit := range defaults {
+		limits[host] = limit
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Printf("Ignoring invalid HTTP_RATE_LIMITS entry %q", entry)
+			continue
+		}
+		rpsText, burstText, _ := strings.Cut(value, ":")
+		rps, err := strconv.ParseFloat(rpsText, 64)
+		if err != nil || rps <= 0 {
+			log.Printf("Ignoring invalid HTTP_RATE_LIMITS entry %q", entry)
+			continue
+		}
+		burst, err := strconv.Atoi(burstText)
+		if err != nil || burst < 1 {
+			burst = int(rps) + 1
+		}
+		limits[strings.TrimSpace(host)] = HostLimit{RPS: rps, Burst: burst}
+	}
+
+	return limits
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := HostLimit{RPS: 2, Burst: 2}
+
+	type step struct {
+		at       time.Duration // time since start
+		op       string        // reserve, throttle, recover or release
+		pause    time.Duration // throttle pause
+		wantWait time.Duration // reserve only
+		wantRate float64       // throttle and recover only
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then refill",
+			steps: []step{
+				{op: "reserve"},
+				{op: "reserve"},
+				{op: "reserve", wantWait: 500 * time.Millisecond},
+				{at: time.Second, op: "reserve"},
+			},
+		},
+		{
+			name: "refill is capped at burst",
+			steps: []step{
+				{op: "reserve"},
+				{at: time.Minute, op: "reserve"},
+				{at: time.Minute, op: "reserve"},
+				{at: time.Minute, op: "reserve", wantWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "throttle drains, halves and blocks",
+			steps: []step{
+				{op: "throttle", pause: 3 * time.Second, wantRate: 1},
+				{at: time.Second, op: "reserve", wantWait: 2 * time.Second},
+				{at: 5 * time.Second, op: "reserve"},
+			},
+		},
+		{
+			name: "throttle keeps the longer block",
+			steps: []step{
+				{op: "throttle", pause: 5 * time.Second, wantRate: 1},
+				{op: "throttle", pause: time.Second, wantRate: 0.5},
+				{at: 2 * time.Second, op: "reserve", wantWait: 3 * time.Second},
+			},
+		},
+		{
+			name: "rate floor",
+			steps: []step{
+				{op: "throttle", wantRate: 1},
+				{op: "throttle", wantRate: 0.5},
+				{op: "throttle", wantRate: 0.25},
+				{op: "throttle", wantRate: 0.125},
+				{op: "throttle", wantRate: 0.125},
+			},
+		},
+		{
+			name: "recover is additive and capped",
+			steps: []step{
+				{op: "throttle", wantRate: 1},
+				{op: "recover", wantRate: 1.04},
+				{op: "recover", wantRate: 1.08},
+				{op: "throttle", wantRate: 0.54},
+			},
+		},
+		{
+			name: "recover never exceeds the limit",
+			steps: []step{
+				{op: "recover", wantRate: 2},
+			},
+		},
+		{
+			name: "release returns a token",
+			steps: []step{
+				{op: "reserve"},
+				{op: "reserve"},
+				{op: "reserve", wantWait: 500 * time.Millisecond},
+				{op: "release"},
+				{op: "reserve", wantWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "release is capped at burst",
+			steps: []step{
+				{op: "release"},
+				{op: "reserve"},
+				{op: "reserve"},
+				{op: "reserve", wantWait: 500 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(limit)
+			b.last = start
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				switch s.op {
+				case "reserve":
+					if wait := b.reserve(now); wait != s.wantWait {
+						t.Errorf("step %d: wait %v, want %v", i, wait, s.wantWait)
+					}
+				case "throttle":
+					if rate := b.throttle(now, s.pause); !closeTo(rate, s.wantRate) {
+						t.Errorf("step %d: rate %v, want %v", i, rate, s.wantRate)
+					}
+				case "recover":
+					b.recover()
+					if !closeTo(b.rate, s.wantRate) {
+						t.Errorf("step %d: rate %v, want %v", i, b.rate, s.wantRate)
+					}
+				case "release":
+					b.release()
+				}
+			}
+		})
+	}
+}
+
+func closeTo(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestNewTokenBucketDefaults(t *testing.T) {
+	b := newTokenBucket(HostLimit{})
+	if b.limit.RPS != fallbackHostLimit.RPS || b.limit.Burst != 1 || b.tokens != 1 {
+		t.Errorf("got limit %+v with %v tokens", b.limit, b.tokens)
+	}
+}
+
+func TestRateLimiterWaitReturnsTokenOnCancel(t *testing.T) {
+	l := NewRateLimiter(map[string]HostLimit{"example.com": {RPS: 0.01, Burst: 1}})
+	if err := l.Wait(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next token is 100s away, so the wait ends with the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "example.com"); err == nil {
+		t.Fatal("expected the wait to be cancelled")
+	}
+
+	b := l.bucket("example.com")
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens < -0.01 {
+		t.Errorf("bucket holds %v tokens after a cancelled wait, want about 0", tokens)
+	}
+
+	// An already cancelled context does not consume a token either
+	done, cancelDone := context.WithCancel(context.Background())
+	cancelDone()
+	l.SetHostLimit("example.com", HostLimit{RPS: 1, Burst: 1})
+	if err := l.Wait(done, "example.com"); err == nil {
+		t.Fatal("expected a cancelled context to fail")
+	}
+	if err := l.Wait(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if wait := l.bucket("example.com").reserve(time.Now()); wait <= 0 {
+		t.Error("the token of the cancelled wait was not the only one left")
+	}
+}
+
+func TestParseHostLimits(t *testing.T) {
+	defaults := map[string]HostLimit{
+		"prices.azure.com":     {RPS: 5, Burst: 10},
+		"management.azure.com": {RPS: 3, Burst: 6},
+	}
+	tests := []struct {
+		name string
+		spec string
+		want map[string]HostLimit
+	}{
+		{
+			name: "empty keeps the defaults",
+			want: defaults,
+		},
+		{
+			name: "override and add",
+			spec: " prices.azure.com=1:2 , example.com=0.5:1",
+			want: map[string]HostLimit{
+				"prices.azure.com":     {RPS: 1, Burst: 2},
+				"management.azure.com": {RPS: 3, Burst: 6},
+				"example.com":          {RPS: 0.5, Burst: 1},
+			},
+		},
+		{
+			name: "missing or invalid burst follows the rate",
+			spec: "prices.azure.com=4,management.azure.com=2.5:0",
+			want: map[string]HostLimit{
+				"prices.azure.com":     {RPS: 4, Burst: 5},
+				"management.azure.com": {RPS: 2.5, Burst: 3},
+			},
+		},
+		{
+			name: "invalid entries are ignored",
+			spec: "prices.azure.com,management.azure.com=fast:2,example.com=0:1,,",
+			want: defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHostLimits(tt.spec, defaults)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for host, limit := range tt.want {
+				if got[host] != limit {
+					t.Errorf("%s: got %+v, want %+v", host, got[host], limit)
+				}
+			}
+		})
+	}
+
+	if defaults["prices.azure.com"].RPS != 5 {
+		t.Error("parseHostLimits modified the defaults")
+	}
+}
+
+func TestLimiterReadsHTTPRateLimits(t *testing.T) {
+	// Restore the shared limiter, or let the next caller build it again
+	saved := sharedLimiter
+	t.Cleanup(func() {
+		sharedLimiter, sharedLimiterOnce = saved, sync.Once{}
+		if saved != nil {
+			sharedLimiterOnce.Do(func() {})
+		}
+	})
+
+	t.Setenv("HTTP_RATE_LIMITS", "prices.azure.com=1:3")
+	sharedLimiter, sharedLimiterOnce = nil, sync.Once{}
+
+	l := Limiter()
+	if got := l.limits["prices.azure.com"]; got != (HostLimit{RPS: 1, Burst: 3}) {
+		t.Errorf("prices.azure.com: got %+v", got)
+	}
+	if got := l.limits["management.azure.com"]; got != defaultHostLimits["management.azure.com"] {
+		t.Errorf("management.azure.com: got %+v, want the default", got)
+	}
+	if Limiter() != l {
+		t.Error("Limiter returned a different limiter on the second call")
+	}
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how outbound requests are retried on throttling and transient failures
+type RetryPolicy struct {
+	MaxAttempts   int           // attempts per request, including the first one
+	BaseDelay     time.Duration // backoff before the first retry, doubled on every further attempt
+	MaxDelay      time.Duration // upper bound for a computed backoff (Retry-After may exceed it)
+	MaxRunRetries int64         // retries allowed across a whole import run, 0 means unlimited
+}
+
+// ErrRetryBudgetExhausted is returned once an import run has used up MaxRunRetries
+var ErrRetryBudgetExhausted = errors.New("retry budget for this run exhausted")
+
+// HTTPError is returned for any non-200 response
+type HTTPError struct {
+	StatusCode int
+	Body       []byte
+	RetryAfter time.Duration // parsed Retry-After header, zero when absent
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("received non-200 response: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again
+func (e *HTTPError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+var (
+	retryPolicy atomic.Pointer[RetryPolicy]
+	runRetries  atomic.Int64
+)
+
+// GetRetryPolicy returns the active retry policy, read from the environment on first use:
+// HTTP_MAX_ATTEMPTS, HTTP_RETRY_BASE_DELAY, HTTP_RETRY_MAX_DELAY and HTTP_MAX_RUN_RETRIES
+func GetRetryPolicy() RetryPolicy {
+	if policy := retryPolicy.Load(); policy != nil {
+		return *policy
+	}
+	retryPolicy.CompareAndSwap(nil, &RetryPolicy{
+		MaxAttempts:   envInt("HTTP_MAX_ATTEMPTS", 6),
+		BaseDelay:     envDuration("HTTP_RETRY_BASE_DELAY", time.Second),
+		MaxDelay:      envDuration("HTTP_RETRY_MAX_DELAY", time.Minute),
+		MaxRunRetries: int64(envInt("HTTP_MAX_RUN_RETRIES", 500)),
+	})
+	return *retryPolicy.Load()
+}
+
+// SetRetryPolicy replaces the active retry policy
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicy.Store(&policy)
+}
+
+// ResetRetryBudget starts a new run, giving it a fresh MaxRunRetries allowance
+func ResetRetryBudget() {
+	runRetries.Store(0)
+}
+
+// requestTimeout bounds a single attempt, from HTTP_REQUEST_TIMEOUT (default 1m)
+func requestTimeout() time.Duration {
+	return envDuration("HTTP_REQUEST_TIMEOUT", time.Minute)
+}
+
+// doWithRetry sends the request built by newRequest until it succeeds, fails with a
+// non-retryable error, ctx is done, or the per-request or per-run retry limit is
+// reached. newRequest is called once per attempt, with a context carrying the attempt's
+// deadline, so request bodies can be rebuilt.
+func doWithRetry(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) ([]byte, error) {
+	policy := GetRetryPolicy()
+
+	for attempt := 1; ; attempt++ {
+		body, host, err := attemptOnce(ctx, newRequest)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		if !retryable(err) {
+			return nil, err
+		}
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			if httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode == http.StatusServiceUnavailable {
+				Limiter().Throttled(host, httpErr.RetryAfter)
+			}
+		}
+		if attempt >= policy.MaxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		if policy.MaxRunRetries > 0 && runRetries.Add(1) > policy.MaxRunRetries {
+			return nil, fmt.Errorf("%w: %v", ErrRetryBudgetExhausted, err)
+		}
+
+		delay := backoff(policy, attempt)
+		if httpErr != nil && httpErr.RetryAfter > delay {
+			delay = httpErr.RetryAfter
+		}
+		log.Printf("Request to %s failed (attempt %d/%d): %v, retrying in %s", host, attempt, policy.MaxAttempts, err, delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether a failed attempt may succeed if sent again: retryable HTTP
+// statuses, timeouts, and connections that were refused, reset or cut short. Errors
+// building the request or reading a complete response are permanent.
+func retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Retryable()
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// The attempt's own deadline; the caller's context is checked before
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// attemptOnce waits for the rate limiter and sends one request bounded by requestTimeout
+func attemptOnce(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) ([]byte, string, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+
+	req, err := newRequest(attemptCtx)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	if err := Limiter().Wait(attemptCtx, req.URL.Host); err != nil {
+		return nil, req.URL.Host, err
+	}
+	body, err := doOnce(req)
+	return body, req.URL.Host, err
+}
+
+// sleepContext sleeps for d or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// doOnce sends a single request and returns the body of a 200 response
+func doOnce(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error executing HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       body,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	// ARM reports the remaining request quota in x-ms-ratelimit-remaining-* headers;
+	// once one of them hits zero, slow down before the host starts rejecting requests
+	if rateLimitExhausted(resp.Header) {
+		pause := parseRetryAfter(resp.Header.Get("Retry-After"))
+		if pause == 0 {
+			pause = GetRetryPolicy().BaseDelay
+		}
+		Limiter().Throttled(req.URL.Host, pause)
+	} else {
+		Limiter().Succeeded(req.URL.Host)
+	}
+
+	return body, nil
+}
+
+// backoff returns the exponential delay for the given attempt with jitter applied
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	// Equal jitter: keep half the delay and randomise the rest
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// rateLimitExhausted reports whether any x-ms-ratelimit-remaining-* header is zero
+func rateLimitExhausted(header http.Header) bool {
+	for name, values := range header {
+		if !strings.HasPrefix(strings.ToLower(name), "x-ms-ratelimit-remaining-") {
+			continue
+		}
+		for _, value := range values {
+			if remaining, err := strconv.Atoi(value); err == nil && remaining <= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(key string, def int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return def
+}
+
+// envDuration reads a duration such as "500ms" or "2s" from the environment, falling back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return def
+}
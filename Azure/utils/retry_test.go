@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoWithRetryRetriesOnlyTransientErrors(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	ResetRetryBudget()
+
+	var calls atomic.Int32
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	get := func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	}
+
+	if _, err := doWithRetry(context.Background(), get); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 3 {
+		t.Errorf("502: %d attempts, want 3", calls.Load())
+	}
+
+	calls.Store(0)
+	status = http.StatusBadRequest
+	if _, err := doWithRetry(context.Background(), get); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("400: %d attempts, want 1", calls.Load())
+	}
+
+	// A request that cannot be built is never sent again
+	built := 0
+	_, err := doWithRetry(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		built++
+		return nil, errors.New("bad request body")
+	})
+	if err == nil || built != 1 {
+		t.Errorf("request builder called %d times, err %v", built, err)
+	}
+}
+
+func TestDoWithRetryRetriesRefusedConnections(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	ResetRetryBudget()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	built := 0
+	_, err := doWithRetry(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		built++
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	})
+	if err == nil || built != 2 {
+		t.Errorf("refused connection attempted %d times, err %v", built, err)
+	}
+}
+
+func TestDoWithRetryHonoursRetryAfter(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	tests := []struct {
+		name       string
+		retryAfter func() string
+		minDelay   time.Duration
+	}{
+		{"seconds", func() string { return "1" }, time.Second},
+		// HTTP dates have a resolution of one second
+		{"HTTP date", func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) }, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetRetryBudget()
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter())
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			start := time.Now()
+			body, err := doWithRetry(context.Background(), func(ctx context.Context) (*http.Request, error) {
+				return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != "ok" || calls.Load() != 2 {
+				t.Errorf("got %q after %d attempts", body, calls.Load())
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.minDelay)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"7", 7 * time.Second, 7 * time.Second},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{"no quota headers", map[string]string{"Content-Type": "application/json"}, false},
+		{"quota left", map[string]string{"x-ms-ratelimit-remaining-subscription-reads": "11999"}, false},
+		{"reads exhausted", map[string]string{"x-ms-ratelimit-remaining-subscription-reads": "0"}, true},
+		{"one of several exhausted", map[string]string{
+			"x-ms-ratelimit-remaining-subscription-reads":             "100",
+			"x-ms-ratelimit-remaining-subscription-resource-requests": "0",
+		}, true},
+		{"tenant quota", map[string]string{"X-Ms-Ratelimit-Remaining-Tenant-Reads": "0"}, true},
+		{"unparsable value", map[string]string{"x-ms-ratelimit-remaining-subscription-reads": "n/a"}, false},
+		{"other header at zero", map[string]string{"x-ms-request-charge": "0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+			if got := rateLimitExhausted(header); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryStopsAtRunBudget(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxRunRetries: 2})
+	ResetRetryBudget()
+	t.Cleanup(ResetRetryBudget)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	get := func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	}
+
+	// The first request uses up both retries of the run
+	if _, err := doWithRetry(context.Background(), get); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("got %v, want ErrRetryBudgetExhausted", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("first request: %d attempts, want 3", calls.Load())
+	}
+
+	// Later requests of the same run are no longer retried
+	calls.Store(0)
+	if _, err := doWithRetry(context.Background(), get); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("got %v, want ErrRetryBudgetExhausted", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("second request: %d attempts, want 1", calls.Load())
+	}
+
+	// A new run gets a fresh budget
+	ResetRetryBudget()
+	calls.Store(0)
+	doWithRetry(context.Background(), get)
+	if calls.Load() != 3 {
+		t.Errorf("new run: %d attempts, want 3", calls.Load())
+	}
+}
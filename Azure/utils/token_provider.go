@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// AccessToken is a bearer token and the time it stops being valid
+type AccessToken struct {
+	Token     string
+	ExpiresOn time.Time
+}
+
+// TokenSource requests a new access token for a scope
+type TokenSource func(ctx context.Context, scope string) (AccessToken, error)
+
+// TokenProvider caches one access token per scope and requests a new one shortly before
+// the cached token expires. It is safe for concurrent use; callers asking for the same
+// scope while a refresh is in flight wait for that refresh instead of starting another.
+type TokenProvider struct {
+	source        TokenSource
+	refreshBefore time.Duration
+
+	mu     sync.Mutex
+	scopes map[string]*scopeToken
+}
+
+// scopeToken guards the cached token of a single scope
+type scopeToken struct {
+	mu    sync.Mutex
+	token AccessToken
+}
+
+// NewTokenProvider returns a TokenProvider that requests tokens from source
+func NewTokenProvider(source TokenSource) *TokenProvider {
+	return &TokenProvider{
+		source:        source,
+		refreshBefore: 5 * time.Minute,
+		scopes:        map[string]*scopeToken{},
+	}
+}
+
+// Token returns a valid access token for scope, requesting a new one when the cached
+// token is missing or about to expire
+func (p *TokenProvider) Token(ctx context.Context, scope string) (string, error) {
+	entry := p.entry(scope)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.token.Token != "" && time.Until(entry.token.ExpiresOn) > p.refreshBefore {
+		return entry.token.Token, nil
+	}
+
+	token, err := p.source(ctx, scope)
+	if err != nil {
+		return "", fmt.Errorf("error generating bearer token: %w", err)
+	}
+	entry.token = token
+	log.Printf("Acquired token for %s, valid until %s", scope, token.ExpiresOn.Format(time.RFC3339))
+	return token.Token, nil
+}
+
+// Invalidate drops the cached token of scope if it is still the given one, so the next
+// call to Token requests a new token. Passing the rejected token keeps concurrent
+// callers that hit the same 401 from discarding a token that was just refreshed.
+func (p *TokenProvider) Invalidate(scope, rejected string) {
+	entry := p.entry(scope)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.token.Token == rejected {
+		entry.token = AccessToken{}
+	}
+}
+
+func (p *TokenProvider) entry(scope string) *scopeToken {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.scopes[scope]
+	if !ok {
+		entry = &scopeToken{}
+		p.scopes[scope] = entry
+	}
+	return entry
+}
+
+var (
+	defaultTokenProvider     *TokenProvider
+	defaultTokenProviderOnce sync.Once
+)
+
+// DefaultTokenProvider returns the process-wide provider using the credentials
+// configured in the environment, see LoadCredentialConfig
+func DefaultTokenProvider() *TokenProvider {
+	defaultTokenProviderOnce.Do(func() {
+		cfg, err := LoadCredentialConfig()
+		var source TokenSource
+		if err == nil {
+			source, err = NewCredential(cfg)
+		}
+		if err != nil {
+			source = func(ctx context.Context, scope string) (AccessToken, error) {
+				return AccessToken{}, fmt.Errorf("invalid credential configuration: %w", err)
+			}
+		}
+		defaultTokenProvider = NewTokenProvider(source)
+	})
+	return defaultTokenProvider
+}
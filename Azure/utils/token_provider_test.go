@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSource issues numbered tokens valid for lifetime and counts the requests per scope
+type countingSource struct {
+	mu       sync.Mutex
+	lifetime time.Duration
+	issued   map[string]int
+}
+
+func (s *countingSource) source(ctx context.Context, scope string) (AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.issued == nil {
+		s.issued = map[string]int{}
+	}
+	s.issued[scope]++
+	return AccessToken{Token: fmt.Sprintf("%s#%d", scope, s.issued[scope]), ExpiresOn: time.Now().Add(s.lifetime)}, nil
+}
+
+func (s *countingSource) count(scope string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued[scope]
+}
+
+func TestTokenProviderCachesPerScope(t *testing.T) {
+	src := &countingSource{lifetime: time.Hour}
+	p := NewTokenProvider(src.source)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		for _, scope := range []string{"arm", "graph"} {
+			token, err := p.Token(ctx, scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != scope+"#1" {
+				t.Errorf("%s: got %q, want the cached first token", scope, token)
+			}
+		}
+	}
+	if src.count("arm") != 1 || src.count("graph") != 1 {
+		t.Errorf("requested arm %d and graph %d times, want once each", src.count("arm"), src.count("graph"))
+	}
+}
+
+func TestTokenProviderRefreshesBeforeExpiry(t *testing.T) {
+	// Every token is already inside the refresh window when it is issued
+	src := &countingSource{lifetime: 4 * time.Minute}
+	p := NewTokenProvider(src.source)
+
+	for want := 1; want <= 2; want++ {
+		token, err := p.Token(context.Background(), "arm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != fmt.Sprintf("arm#%d", want) {
+			t.Errorf("got %q, want arm#%d", token, want)
+		}
+	}
+
+	// Outside the window the token is kept
+	src.lifetime = time.Hour
+	p.Invalidate("arm", "arm#2")
+	first, _ := p.Token(context.Background(), "arm")
+	second, _ := p.Token(context.Background(), "arm")
+	if first != "arm#3" || second != "arm#3" {
+		t.Errorf("got %q then %q, want arm#3 twice", first, second)
+	}
+}
+
+func TestTokenProviderSharesOneRefresh(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	p := NewTokenProvider(func(ctx context.Context, scope string) (AccessToken, error) {
+		calls.Add(1)
+		<-release
+		return AccessToken{Token: "shared", ExpiresOn: time.Now().Add(time.Hour)}, nil
+	})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = p.Token(context.Background(), "arm")
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("source called %d times, want 1", calls.Load())
+	}
+	for i, token := range tokens {
+		if token != "shared" {
+			t.Errorf("caller %d got %q", i, token)
+		}
+	}
+}
+
+func TestTokenProviderInvalidate(t *testing.T) {
+	src := &countingSource{lifetime: time.Hour}
+	p := NewTokenProvider(src.source)
+	ctx := context.Background()
+
+	rejected, _ := p.Token(ctx, "arm")
+	p.Invalidate("arm", rejected)
+	refreshed, _ := p.Token(ctx, "arm")
+	if refreshed != "arm#2" {
+		t.Fatalf("got %q after invalidating, want arm#2", refreshed)
+	}
+
+	// A second caller rejected with the old token must not drop the new one
+	p.Invalidate("arm", rejected)
+	if token, _ := p.Token(ctx, "arm"); token != refreshed {
+		t.Errorf("got %q, want the refreshed %q", token, refreshed)
+	}
+	if src.count("arm") != 2 {
+		t.Errorf("source called %d times, want 2", src.count("arm"))
+	}
+}
+
+func TestTokenProviderSourceError(t *testing.T) {
+	p := NewTokenProvider(func(ctx context.Context, scope string) (AccessToken, error) {
+		return AccessToken{}, errors.New("no credentials")
+	})
+	if _, err := p.Token(context.Background(), "arm"); err == nil {
+		t.Fatal("expected an error")
+	}
+}